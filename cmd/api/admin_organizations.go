@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+const organizationCtx contextKey = "organization"
+
+type CreateOrganizationPayload struct {
+	Name string `json:"name"`
+}
+
+type SetUserOrganizationPayload struct {
+	// OrganizationID is empty to remove the user from their organization.
+	OrganizationID string `json:"organization_id"`
+}
+
+func (a *app) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateOrganizationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" || len(payload.Name) > 255 {
+		a.badRequestException(w, r, fmt.Errorf("invalid name"))
+		return
+	}
+
+	org := &store.Organization{Name: payload.Name}
+	if err := a.store.Organizations.Create(r.Context(), org); err != nil {
+		switch err {
+		case store.ErrDuplicateOrganization:
+			a.conflictException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:   store.AuditActionOrganizationCreated,
+		ActorID:  getUserFromContext(r).ID,
+		Metadata: map[string]any{"organization_id": org.ID, "name": org.Name},
+	})
+
+	if err := a.jsonResponse(w, http.StatusCreated, org); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) listOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	orgs, err := a.store.Organizations.List(r.Context())
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, orgs); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) getOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.jsonResponse(w, http.StatusOK, getOrganizationFromContext(r)); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) deleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	org := getOrganizationFromContext(r)
+
+	if err := a.store.Organizations.Delete(r.Context(), org.ID); err != nil {
+		switch err {
+		case store.ErrOrganizationNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:   store.AuditActionOrganizationDeleted,
+		ActorID:  getUserFromContext(r).ID,
+		Metadata: map[string]any{"organization_id": org.ID, "name": org.Name},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) setUserOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	user := getTargetUserFromContext(r)
+
+	var payload SetUserOrganizationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	if payload.OrganizationID != "" {
+		if _, err := a.store.Organizations.GetByID(r.Context(), payload.OrganizationID); err != nil {
+			switch err {
+			case store.ErrOrganizationNotFound:
+				a.badRequestException(w, r, err)
+			default:
+				a.internalServerException(w, r, err)
+			}
+			return
+		}
+	}
+
+	if err := a.store.Users.SetOrganization(r.Context(), user.ID, payload.OrganizationID); err != nil {
+		switch err {
+		case store.ErrOrganizationNotFound:
+			a.badRequestException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+	user.OrganizationID = payload.OrganizationID
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserOrganizationSet,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"organization_id": payload.OrganizationID},
+	})
+
+	if err := a.jsonResponse(w, http.StatusOK, user); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+// organizationContextMiddleware loads the organization addressed by the
+// {organizationID} URL parameter.
+func (a *app) organizationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		org, err := a.store.Organizations.GetByID(r.Context(), chi.URLParam(r, "organizationID"))
+		if err != nil {
+			switch err {
+			case store.ErrOrganizationNotFound:
+				a.notFoundException(w, r, err)
+			default:
+				a.internalServerException(w, r, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), organizationCtx, org)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getOrganizationFromContext(r *http.Request) *store.Organization {
+	org, _ := r.Context().Value(organizationCtx).(*store.Organization)
+	return org
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+type ListOutboxResponse struct {
+	Messages   []*store.OutboxMessage `json:"messages"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+func (a *app) listOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	filter := store.OutboxFilter{
+		Status: query.Get("status"),
+		Limit:  limit,
+	}
+
+	switch filter.Status {
+	case "", store.OutboxStatusPending, store.OutboxStatusSent, store.OutboxStatusDead:
+	default:
+		a.badRequestException(w, r, fmt.Errorf("invalid status"))
+		return
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		filter.Cursor, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || filter.Cursor < 1 {
+			a.badRequestException(w, r, fmt.Errorf("invalid cursor"))
+			return
+		}
+	}
+
+	messages, err := a.store.Outbox.List(r.Context(), filter)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	response := ListOutboxResponse{Messages: messages}
+	if len(messages) == filter.Limit {
+		response.NextCursor = strconv.FormatInt(messages[len(messages)-1].ID, 10)
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, response); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+// replayOutboxHandler moves a dead-lettered message back to the queue.
+func (a *app) replayOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+	if err != nil {
+		a.badRequestException(w, r, fmt.Errorf("invalid message id"))
+		return
+	}
+
+	if err := a.store.Outbox.Replay(r.Context(), id); err != nil {
+		switch err {
+		case store.ErrOutboxMessageNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:   store.AuditActionOutboxReplayed,
+		ActorID:  getUserFromContext(r).ID,
+		Metadata: map[string]any{"message_id": id},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/outbox"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	return errors.New("smtp unavailable")
+}
+
+func TestOutbox(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	adminID := "86990727-379a-42ea-a71d-69179969e777"
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: adminID, Email: "admin@test.com"})
+
+	notification, err := app.emailNotification(&store.User{Email: "user@test.com"}, mailer.TemplateLockout, map[string]any{
+		"Email":  "user@test.com",
+		"Reason": "test",
+		"Time":   time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.store.Sessions.UpsertWithOutbox(context.Background(), &store.Session{UserID: adminID}, notification, notification)
+
+	mockOutboxStore := app.store.Outbox.(*store.MockOutboxStore)
+	if len(mockOutboxStore.Messages) != 1 {
+		t.Fatalf("expected idempotency key to deduplicate messages, got %d", len(mockOutboxStore.Messages))
+	}
+
+	mux := app.mount()
+
+	t.Run("should dead-letter after max attempts", func(t *testing.T) {
+		worker := outbox.NewWorker(app.store.Outbox, failingMailer{}, outbox.Config{
+			BatchSize:   10,
+			MaxAttempts: 2,
+		})
+
+		for range 2 {
+			if _, err := worker.ProcessDue(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		msg := mockOutboxStore.Messages[0]
+		if msg.Status != store.OutboxStatusDead || msg.Attempts != 2 || msg.LastError == "" {
+			t.Errorf("expected dead message after 2 attempts, got %+v", msg)
+		}
+	})
+
+	t.Run("should replay dead message", func(t *testing.T) {
+		id := strconv.FormatInt(mockOutboxStore.Messages[0].ID, 10)
+
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/outbox/"+id+"/replay", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "outbox:manage"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+		worker := outbox.NewWorker(app.store.Outbox, app.mailer, outbox.Config{
+			BatchSize:   10,
+			MaxAttempts: 2,
+			BaseBackoff: time.Minute,
+			MaxBackoff:  time.Hour,
+		})
+		if _, err := worker.ProcessDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		messages := app.mailer.(*mailer.MemoryMailer).Messages()
+		if len(messages) != 1 || messages[0].ID != notification.IdempotencyKey {
+			t.Errorf("expected replayed message to be delivered with its idempotency key, got %+v", messages)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lostxs/BackDev-test/internal/ippolicy"
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/webhook"
+)
+
+const targetUserCtx contextKey = "target_user"
+
+var errSelfAction = errors.New("admins cannot perform this action on themselves")
+
+type CreateUserPayload struct {
+	Email  string   `json:"email"`
+	Locale string   `json:"locale"`
+	Roles  []string `json:"roles"`
+}
+
+type SetIPChangePolicyPayload struct {
+	// Policy is one of ippolicy.Policy values, empty resets to the global policy.
+	Policy string `json:"policy"`
+}
+
+type ListUsersResponse struct {
+	Users      []*store.User `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+func (a *app) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	addr, err := mail.ParseAddress(payload.Email)
+	if err != nil || addr.Address != payload.Email {
+		a.badRequestException(w, r, fmt.Errorf("invalid email"))
+		return
+	}
+
+	if len(payload.Roles) == 0 {
+		payload.Roles = []string{"user"}
+	}
+
+	if len(payload.Locale) > 16 {
+		a.badRequestException(w, r, fmt.Errorf("invalid locale"))
+		return
+	}
+
+	user := &store.User{Email: payload.Email, Locale: payload.Locale}
+	if err := a.store.Users.CreateWithRoles(r.Context(), user, payload.Roles); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateEmail):
+			a.conflictException(w, r, err)
+		case errors.Is(err, store.ErrRoleNotFound):
+			a.badRequestException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserCreated,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"roles": payload.Roles},
+	})
+
+	if err := a.jsonResponse(w, http.StatusCreated, user); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	filter := store.UserFilter{
+		Cursor: query.Get("cursor"),
+		Limit:  limit,
+		Search: query.Get("email"),
+	}
+
+	users, err := a.store.Users.List(r.Context(), filter)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidUserID:
+			a.badRequestException(w, r, fmt.Errorf("invalid cursor"))
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	response := ListUsersResponse{Users: users}
+	if len(users) == filter.Limit {
+		response.NextCursor = users[len(users)-1].ID
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, response); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getTargetUserFromContext(r)
+
+	if err := a.jsonResponse(w, http.StatusOK, user); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) disableUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getTargetUserFromContext(r)
+
+	if user.ID == getUserFromContext(r).ID {
+		a.badRequestException(w, r, errSelfAction)
+		return
+	}
+
+	if err := a.store.Users.Disable(r.Context(), user.ID); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserDisabled,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: user.ID,
+	})
+	a.dispatchWebhook(r, webhook.EventUserLocked, map[string]any{
+		"user_id": user.ID,
+		"reason":  "disabled by admin",
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) enableUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getTargetUserFromContext(r)
+
+	if err := a.store.Users.Enable(r.Context(), user.ID); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserEnabled,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: user.ID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) setIPChangePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getTargetUserFromContext(r)
+
+	var payload SetIPChangePolicyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	if payload.Policy != "" {
+		if _, err := ippolicy.Parse(payload.Policy); err != nil {
+			a.badRequestException(w, r, err)
+			return
+		}
+	}
+
+	if err := a.store.Users.SetIPChangePolicy(r.Context(), user.ID, payload.Policy); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+	user.IPChangePolicy = payload.Policy
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserIPPolicySet,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"policy": payload.Policy},
+	})
+
+	if err := a.jsonResponse(w, http.StatusOK, user); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getTargetUserFromContext(r)
+
+	if user.ID == getUserFromContext(r).ID {
+		a.badRequestException(w, r, errSelfAction)
+		return
+	}
+
+	if err := a.store.Users.Delete(r.Context(), user.ID); err != nil {
+		switch err {
+		case store.ErrUserNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserDeleted,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"email": user.Email},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminUserContextMiddleware loads the user addressed by the {userID} URL
+// parameter, unlike getUser it does not reject disabled users.
+func (a *app) adminUserContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.store.Users.GetByID(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			switch err {
+			case store.ErrInvalidUserID:
+				a.badRequestException(w, r, err)
+			case store.ErrUserNotFound:
+				a.notFoundException(w, r, err)
+			default:
+				a.internalServerException(w, r, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), targetUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getTargetUserFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(targetUserCtx).(*store.User)
+	return user
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func TestAdminUsersHandlers(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	adminID := "86990727-379a-42ea-a71d-69179969e777"
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{
+		ID:    adminID,
+		Email: "admin@test.com",
+	})
+
+	adminToken := newTestAccessToken(t, app, adminID, "users:read", "users:write")
+
+	mux := app.mount()
+
+	t.Run("should return 403 without permission", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should return 403 outside the granted scope", func(t *testing.T) {
+		token, err := app.authenticator.GenerateAccessToken(jwt.MapClaims{
+			"sub":         adminID,
+			"ip_address":  "127.0.0.1",
+			"permissions": []string{"users:read", "users:write"},
+			"scope":       "users:read",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		req, err = http.NewRequest(http.MethodPost, "/api/admin/users", strings.NewReader(`{"email":"scoped@test.com"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should create user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/users", strings.NewReader(`{"email":"new@test.com"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("should return 400 listing unknown roles", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/users", strings.NewReader(`{"email":"typo@test.com","roles":["admn","user","auditr"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+		expected := "role not found: admn, auditr"
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected error message %q, got %q", expected, rr.Body.String())
+		}
+	})
+
+	t.Run("should return 409 on duplicate email", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/users", strings.NewReader(`{"email":"admin@test.com"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should paginate and search users", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/users?limit=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if !strings.Contains(rr.Body.String(), `"next_cursor":`) {
+			t.Errorf("expected next_cursor in response, got %q", rr.Body.String())
+		}
+
+		req, err = http.NewRequest(http.MethodGet, "/api/admin/users?email=new", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if !strings.Contains(rr.Body.String(), "new@test.com") || strings.Contains(rr.Body.String(), "admin@test.com") {
+			t.Errorf("expected only new@test.com in response, got %q", rr.Body.String())
+		}
+
+		req, err = http.NewRequest(http.MethodGet, "/api/admin/users?email=_", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if strings.Contains(rr.Body.String(), "@test.com") {
+			t.Errorf("expected wildcards to match literally, got %q", rr.Body.String())
+		}
+	})
+
+	t.Run("should revoke sessions and reject tokens of disabled user", func(t *testing.T) {
+		user := &store.User{Email: "disabled@test.com"}
+		mockUserStore.Create(context.Background(), nil, user)
+		app.store.Sessions.Upsert(context.Background(), &store.Session{UserID: user.ID})
+
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/users/"+user.ID+"/disable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+
+		if _, err := app.store.Sessions.GetByUserID(context.Background(), user.ID); err != store.ErrSessionNotFound {
+			t.Errorf("expected session to be revoked, got %v", err)
+		}
+
+		req, err = http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, user.ID))
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should not delete self", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/api/admin/users/"+adminID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should validate and set ip change policy", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/api/admin/users/"+adminID+"/ip-change-policy", strings.NewReader(`{"policy":"block"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+		req, err = http.NewRequest(http.MethodPut, "/api/admin/users/"+adminID+"/ip-change-policy", strings.NewReader(`{"policy":"deny"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		user, _ := mockUserStore.GetByID(context.Background(), adminID)
+		if user.IPChangePolicy != "deny" {
+			t.Errorf("expected ip change policy %q, got %q", "deny", user.IPChangePolicy)
+		}
+	})
+}
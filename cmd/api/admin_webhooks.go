@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/webhook"
+)
+
+type CreateWebhookPayload struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+// CreateWebhookResponse is the only response that reveals the signing secret.
+type CreateWebhookResponse struct {
+	*store.WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []*store.WebhookDelivery `json:"deliveries"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+func (a *app) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	u, err := url.Parse(payload.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		a.badRequestException(w, r, fmt.Errorf("url must be an absolute http(s) url"))
+		return
+	}
+
+	if len(payload.EventTypes) == 0 {
+		a.badRequestException(w, r, fmt.Errorf("event_types must not be empty"))
+		return
+	}
+	for _, eventType := range payload.EventTypes {
+		if !webhook.IsEventType(eventType) {
+			a.badRequestException(w, r, fmt.Errorf("unknown event type %q", eventType))
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	endpoint := &store.WebhookEndpoint{
+		URL:        payload.URL,
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: payload.EventTypes,
+	}
+	if err := a.store.Webhooks.Create(r.Context(), endpoint); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:   store.AuditActionWebhookCreated,
+		ActorID:  getUserFromContext(r).ID,
+		Metadata: map[string]any{"webhook_id": endpoint.ID, "url": endpoint.URL},
+	})
+
+	if err := a.jsonResponse(w, http.StatusCreated, CreateWebhookResponse{
+		WebhookEndpoint: endpoint,
+		Secret:          endpoint.Secret,
+	}); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := a.store.Webhooks.List(r.Context())
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, endpoints); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, err := a.store.Webhooks.GetByID(r.Context(), chi.URLParam(r, "webhookID"))
+	if err != nil {
+		switch err {
+		case store.ErrWebhookNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, endpoint); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+
+	if err := a.store.Webhooks.Delete(r.Context(), id); err != nil {
+		switch err {
+		case store.ErrWebhookNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:   store.AuditActionWebhookDeleted,
+		ActorID:  getUserFromContext(r).ID,
+		Metadata: map[string]any{"webhook_id": id},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	var cursor int64
+	if c := query.Get("cursor"); c != "" {
+		cursor, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || cursor < 1 {
+			a.badRequestException(w, r, fmt.Errorf("invalid cursor"))
+			return
+		}
+	}
+
+	endpoint, err := a.store.Webhooks.GetByID(r.Context(), chi.URLParam(r, "webhookID"))
+	if err != nil {
+		switch err {
+		case store.ErrWebhookNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	deliveries, err := a.store.Webhooks.ListDeliveries(r.Context(), endpoint.ID, cursor, limit)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	response := ListWebhookDeliveriesResponse{Deliveries: deliveries}
+	if len(deliveries) == limit {
+		response.NextCursor = strconv.FormatInt(deliveries[len(deliveries)-1].ID, 10)
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, response); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/outbox"
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/webhook"
+)
+
+func TestWebhooks(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	adminID := "86990727-379a-42ea-a71d-69179969e777"
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: adminID, Email: "admin@test.com"})
+
+	type received struct {
+		signature string
+		event     string
+		body      []byte
+	}
+	deliveries := make(chan received, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- received{
+			signature: r.Header.Get(webhook.SignatureHeader),
+			event:     r.Header.Get(webhook.EventHeader),
+			body:      body,
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	mux := app.mount()
+
+	var created struct {
+		Data CreateWebhookResponse `json:"data"`
+	}
+
+	t.Run("should reject unknown event types", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/webhooks", strings.NewReader(`{"url":"`+srv.URL+`","event_types":["session.deleted"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "webhooks:manage"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should register webhook", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/webhooks", strings.NewReader(`{"url":"`+srv.URL+`","event_types":["session.created"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "webhooks:manage"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		if created.Data.Secret == "" {
+			t.Fatal("expected secret in create response")
+		}
+	})
+
+	t.Run("should deliver signed event", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+adminID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		worker := outbox.NewWorker(app.store.Outbox, app.mailer, outbox.Config{BatchSize: 10, MaxAttempts: 1})
+		worker.Handle(webhook.OutboxKind, webhook.NewSender(app.store.Webhooks, time.Second).Deliver)
+
+		if n, err := worker.ProcessDue(context.Background()); err != nil || n != 1 {
+			t.Fatalf("expected one webhook message, got %d: %v", n, err)
+		}
+
+		got := <-deliveries
+		if got.event != webhook.EventSessionCreated {
+			t.Errorf("expected %s event, got %q", webhook.EventSessionCreated, got.event)
+		}
+
+		ts, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(got.signature, ",")[0], "t="), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := webhook.Sign(created.Data.Secret, time.Unix(ts, 0), got.body); got.signature != expected {
+			t.Errorf("expected signature %q, got %q", expected, got.signature)
+		}
+
+		req, err = http.NewRequest(http.MethodGet, "/api/admin/webhooks/"+created.Data.ID+"/deliveries", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "webhooks:manage"))
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if !strings.Contains(rr.Body.String(), `"response_status":204`) {
+			t.Errorf("expected delivery log entry, got %q", rr.Body.String())
+		}
+	})
+}
@@ -1,27 +1,86 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/lostxs/BackDev-test/internal/auth"
+	"github.com/lostxs/BackDev-test/internal/clientip"
+	"github.com/lostxs/BackDev-test/internal/cors"
+	"github.com/lostxs/BackDev-test/internal/geoip"
+	"github.com/lostxs/BackDev-test/internal/ippolicy"
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/outbox"
+	"github.com/lostxs/BackDev-test/internal/ratelimit"
+	"github.com/lostxs/BackDev-test/internal/risk"
 	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/tlsconfig"
+	"github.com/lostxs/BackDev-test/internal/tracing"
 )
 
-// TODO: Implement logger
 type app struct {
-	config        config
+	config config
+	logger *slog.Logger
+	// tls is built from config.tls, nil serves plain HTTP.
+	tls *tls.Config
+	// db is pinged by the readiness probe, nil skips that check.
+	db interface {
+		PingContext(context.Context) error
+	}
 	store         store.Storage
 	authenticator auth.Authenticator
+	mailer        mailer.Mailer
+	templates     *mailer.Templates
+	// geo is nil unless a GeoIP database is configured.
+	geo geoip.Locator
+	// risk is nil unless a risk rules file is configured.
+	risk *risk.Engine
+	// cors is nil unless cross-origin requests are allowed.
+	cors *cors.CORS
+	// limiter is nil when rate limiting is disabled.
+	limiter *ratelimit.Limiter
+	// shuttingDown fails the readiness probe so load balancers stop sending
+	// traffic before the server stops.
+	shuttingDown atomic.Bool
 }
 
 type config struct {
-	addr string
-	db   dbConfig
-	auth authConfig
+	// environment is development or production, only development accepts
+	// default secrets.
+	environment string
+	logLevel    slog.Level
+	addr        string
+	// tls serves addr over HTTPS and HTTP/2 when a certificate is set.
+	tls tlsconfig.Config
+	// metricsAddr is the listener of /metrics, empty disables it.
+	metricsAddr string
+	db          dbConfig
+	auth        authConfig
+	mailer      mailerConfig
+	outbox      outbox.Config
+	// tracing exports spans, none by default.
+	tracing tracing.Config
+	// clientIP trusts forwarding headers from the configured proxies only.
+	clientIP clientip.Resolver
+	geoip    geoipConfig
+	risk     riskConfig
+	// cors lets browser clients on other origins call the API.
+	cors corsConfig
+	// rateLimit throttles token issuance and refresh.
+	rateLimit rateLimitConfig
+	// readiness limits the /readyz checks.
+	readiness readinessConfig
+	shutdown  shutdownConfig
+	// webhookTimeout bounds a single webhook delivery attempt.
+	webhookTimeout time.Duration
 }
 
 type dbConfig struct {
@@ -31,8 +90,111 @@ type dbConfig struct {
 	maxIdleTime  time.Duration
 }
 
+type mailerConfig struct {
+	// kind is either "smtp" or "log", the log mailer writes to file or stdout.
+	kind string
+	file string
+	smtp mailer.SMTPConfig
+	// templatesDir overrides the embedded notification templates.
+	templatesDir string
+}
+
 type authConfig struct {
-	accessToken accessTokenConfig
+	accessToken   accessTokenConfig
+	refreshCookie refreshCookieConfig
+	csrf          csrfConfig
+	impersonation impersonationConfig
+	ipChange      ipChangeConfig
+	stepUp        stepUpConfig
+	// clients are the OAuth client IDs that may identify themselves with
+	// client_id on token issuance, they carry no scopes of their own.
+	clients []string
+}
+
+type csrfConfig struct {
+	// trustedOrigins may make cross-origin requests to cookie-authenticated
+	// endpoints, such as a frontend on another host.
+	trustedOrigins []string
+}
+
+// stepUpConfig guards sensitive endpoints, a zero maxAge or an empty acr
+// disables that requirement.
+type stepUpConfig struct {
+	maxAge time.Duration
+	acr    string
+}
+
+type ipChangeConfig struct {
+	// policy applies to users without their own policy, empty means notify.
+	policy  ippolicy.Policy
+	matcher ippolicy.Matcher
+}
+
+type geoipConfig struct {
+	databases []string
+	// maxTravelSpeed in km/h, zero disables impossible travel detection.
+	maxTravelSpeed float64
+	// impossibleTravelPolicy is applied on top of the IP change policy.
+	impossibleTravelPolicy ippolicy.Policy
+}
+
+type shutdownConfig struct {
+	// delay keeps serving after readiness fails, so load balancers can
+	// take the instance out of rotation.
+	delay time.Duration
+	// timeout bounds draining requests and, separately, flushing the
+	// outbox and telemetry.
+	timeout time.Duration
+}
+
+type readinessConfig struct {
+	// timeout bounds all checks together, zero waits for the request.
+	timeout time.Duration
+	// maxOutboxPending and maxOutboxAge fail readiness when notifications
+	// pile up, zero disables the limit.
+	maxOutboxPending int
+	maxOutboxAge     time.Duration
+}
+
+type riskConfig struct {
+	// rulesFile enables the risk engine, it is reloaded when it changes.
+	rulesFile      string
+	reloadInterval time.Duration
+}
+
+type corsConfig struct {
+	// origins is empty when CORS is disabled.
+	origins        cors.Origins
+	headers        []string
+	exposedHeaders []string
+	// credentials lets allowed origins send the refresh cookie, on the
+	// routes that allow it.
+	credentials bool
+	maxAge      time.Duration
+	// routes override the methods and credentials of the default policy.
+	routes []cors.Route
+}
+
+type rateLimitConfig struct {
+	// backend is memory, postgres or none, only postgres is shared between
+	// replicas.
+	backend string
+	// tokens and refresh are the rules of those routes, each request takes a
+	// token from the bucket of every rule whose key it carries.
+	tokens  []ratelimit.Rule
+	refresh []ratelimit.Rule
+	// pruneInterval drops idle buckets.
+	pruneInterval time.Duration
+}
+
+// maxPeriod is the longest period of any rule, a bucket idle for that long
+// is full again.
+func (c rateLimitConfig) maxPeriod() time.Duration {
+	var period time.Duration
+	for _, rule := range slices.Concat(c.tokens, c.refresh) {
+		period = max(period, rule.Limit.Period)
+	}
+	return period
 }
 
 type accessTokenConfig struct {
@@ -40,26 +202,112 @@ type accessTokenConfig struct {
 	exp    time.Duration
 }
 
+type impersonationConfig struct {
+	exp time.Duration
+}
+
 func (a *app) mount() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(a.ClientIPMiddleware)
+	r.Use(a.TracingMiddleware)
+	r.Use(a.RequestLoggerMiddleware)
+	r.Use(a.MetricsMiddleware)
 	r.Use(middleware.Recoverer)
+	if a.cors != nil {
+		r.Use(a.cors.Handler)
+	}
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	r.Get("/healthz", a.healthzHandler)
+	r.Get("/readyz", a.readyzHandler)
+
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/auth", func(r chi.Router) {
-			r.Get("/tokens", a.createTokensHandler)
-			r.With(a.AccessTokenMiddleware).Get("/refresh", a.refreshTokensHandler)
+			r.With(a.RateLimit("tokens", a.config.rateLimit.tokens)).Get("/tokens", a.createTokensHandler)
+			r.With(a.RefreshMetricsMiddleware, a.CSRFMiddleware, a.AccessTokenMiddleware, a.RejectImpersonation, a.RateLimit("refresh", a.config.rateLimit.refresh)).
+				Post("/refresh", a.refreshTokensHandler)
+			r.With(a.AccessTokenMiddleware, a.RejectImpersonation).Post("/logout", a.logoutHandler)
+		})
+
+		r.With(a.AccessTokenMiddleware).Get("/audit/events", a.listOwnAuditEventsHandler)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(a.AccessTokenMiddleware)
+			r.Use(a.RejectImpersonation)
+
+			stepUp := a.RequireStepUp(a.config.auth.stepUp.maxAge, a.config.auth.stepUp.acr)
+
+			r.With(a.RequirePermission("audit:read")).Get("/audit/events", a.listAuditEventsHandler)
+
+			r.Route("/outbox", func(r chi.Router) {
+				r.Use(a.RequirePermission("outbox:manage"))
+
+				r.Get("/", a.listOutboxHandler)
+				r.Post("/{messageID}/replay", a.replayOutboxHandler)
+			})
+
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(a.RequirePermission("webhooks:manage"))
+
+				r.Get("/", a.listWebhooksHandler)
+				r.Post("/", a.createWebhookHandler)
+				r.Get("/{webhookID}", a.getWebhookHandler)
+				r.Delete("/{webhookID}", a.deleteWebhookHandler)
+				r.Get("/{webhookID}/deliveries", a.listWebhookDeliveriesHandler)
+			})
+
+			r.Route("/organizations", func(r chi.Router) {
+				r.Use(a.RequirePermission("organizations:manage"))
+
+				r.Get("/", a.listOrganizationsHandler)
+				r.Post("/", a.createOrganizationHandler)
+
+				r.Route("/{organizationID}", func(r chi.Router) {
+					r.Use(a.organizationContextMiddleware)
+
+					r.Get("/", a.getOrganizationHandler)
+					r.Delete("/", a.deleteOrganizationHandler)
+					r.Get("/ip-allowlist", a.listAllowlistHandler)
+					r.Post("/ip-allowlist", a.addAllowlistEntryHandler)
+					r.Delete("/ip-allowlist/{entryID}", a.deleteAllowlistEntryHandler)
+				})
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.With(a.RequirePermission("users:read")).Get("/", a.listUsersHandler)
+				r.With(a.RequirePermission("users:write")).Post("/", a.createUserHandler)
+
+				r.Route("/{userID}", func(r chi.Router) {
+					canRead := r.With(a.RequirePermission("users:read"), a.adminUserContextMiddleware)
+					canWrite := r.With(a.RequirePermission("users:write"), a.adminUserContextMiddleware)
+
+					canRead.Get("/", a.getUserHandler)
+					canWrite.With(stepUp).Delete("/", a.deleteUserHandler)
+					canWrite.With(stepUp).Post("/disable", a.disableUserHandler)
+					canWrite.Post("/enable", a.enableUserHandler)
+					canWrite.Put("/ip-change-policy", a.setIPChangePolicyHandler)
+					canWrite.Put("/organization", a.setUserOrganizationHandler)
+					canRead.Get("/ip-allowlist", a.listAllowlistHandler)
+					canWrite.Post("/ip-allowlist", a.addAllowlistEntryHandler)
+					canWrite.Delete("/ip-allowlist/{entryID}", a.deleteAllowlistEntryHandler)
+
+					r.With(a.RequirePermission("users:impersonate"), a.adminUserContextMiddleware, stepUp).
+						Post("/impersonate", a.impersonateUserHandler)
+				})
+			})
 		})
 	})
 
 	return r
 }
 
-func (a *app) run(mux http.Handler) error {
+// run serves until ctx is cancelled. It then fails the readiness probe,
+// gives load balancers the shutdown delay to notice, stops accepting
+// connections and waits up to the shutdown timeout for in-flight requests, so
+// a refresh is never cut off between rotating the hash and sending the cookie.
+func (a *app) run(ctx context.Context, mux http.Handler) error {
 	srv := &http.Server{
 		Addr:         a.config.addr,
 		Handler:      mux,
@@ -68,7 +316,45 @@ func (a *app) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
-	log.Printf("Starting server on %s", a.config.addr)
+	errs := make(chan error, 1)
+	go func() {
+		if a.tls != nil {
+			srv.TLSConfig = a.tls
+			a.logger.Info("starting server", "addr", a.config.addr, "tls", true)
+			errs <- srv.ListenAndServeTLS("", "")
+			return
+		}
+
+		a.logger.Info("starting server", "addr", a.config.addr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
 
-	return srv.ListenAndServe()
+	a.shuttingDown.Store(true)
+	a.logger.Info("shutting down", "delay", a.config.shutdown.delay, "timeout", a.config.shutdown.timeout)
+	time.Sleep(a.config.shutdown.delay)
+
+	return shutdownServer(srv, a.config.shutdown.timeout)
+}
+
+// shutdownServer drains srv within timeout, zero waits as long as it takes.
+func shutdownServer(srv *http.Server, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		// Whatever is still running is cut off.
+		srv.Close()
+		return fmt.Errorf("drain connections: %w", err)
+	}
+	return nil
 }
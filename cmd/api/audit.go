@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+type ListAuditEventsResponse struct {
+	Events     []*store.AuditEvent `json:"events"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// recordAuditEvent stores an audit event enriched with the request metadata.
+func (a *app) recordAuditEvent(r *http.Request, event *store.AuditEvent) error {
+	event.IPAddress = getClientIP(r)
+	event.Location = a.locate(r, event.IPAddress)
+	event.UserAgent = r.UserAgent()
+	event.RequestID = middleware.GetReqID(r.Context())
+
+	return a.store.Audit.Create(r.Context(), event)
+}
+
+// auditEvent is the best-effort variant of recordAuditEvent for flows that
+// must not fail because the audit log is unavailable.
+func (a *app) auditEvent(r *http.Request, event *store.AuditEvent) {
+	if err := a.recordAuditEvent(r, event); err != nil {
+		logging.FromContext(r.Context()).Error("record audit event", "action", event.Action, "error", err)
+	}
+}
+
+// listOwnAuditEventsHandler returns events where the caller is the subject.
+func (a *app) listOwnAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	filter.ActorID = ""
+	filter.SubjectID = getUserFromContext(r).ID
+
+	a.listAuditEvents(w, r, filter)
+}
+
+func (a *app) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	a.listAuditEvents(w, r, filter)
+}
+
+func (a *app) listAuditEvents(w http.ResponseWriter, r *http.Request, filter store.AuditFilter) {
+	events, err := a.store.Audit.List(r.Context(), filter)
+	if err != nil {
+		switch err {
+		case store.ErrInvalidUserID:
+			a.badRequestException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	response := ListAuditEventsResponse{Events: events}
+	if len(events) == filter.Limit {
+		response.NextCursor = strconv.FormatInt(events[len(events)-1].ID, 10)
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, response); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func parseAuditFilter(r *http.Request) (store.AuditFilter, error) {
+	query := r.URL.Query()
+
+	limit, err := parseLimitParam(query)
+	if err != nil {
+		return store.AuditFilter{}, err
+	}
+
+	filter := store.AuditFilter{
+		ActorID:   query.Get("actor_id"),
+		SubjectID: query.Get("subject_id"),
+		Action:    query.Get("action"),
+		Limit:     limit,
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		filter.Cursor, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || filter.Cursor < 1 {
+			return store.AuditFilter{}, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func TestAuditEvents(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	adminID := "86990727-379a-42ea-a71d-69179969e777"
+	userID := "1e2e06f9-a42f-4e9e-a5e0-f2f376e70dc6"
+
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: adminID, Email: "admin@test.com"})
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: userID, Email: "user@test.com"})
+
+	mux := app.mount()
+
+	for _, id := range []string{adminID, userID} {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("User-Agent", "audit-test")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	}
+
+	t.Run("should record token issuance with request metadata", func(t *testing.T) {
+		events := app.store.Audit.(*store.MockAuditStore).Events
+		if len(events) != 2 {
+			t.Fatalf("expected 2 audit events, got %d", len(events))
+		}
+
+		event := events[1]
+		if event.Action != store.AuditActionSessionCreated || event.SubjectID != userID {
+			t.Errorf("expected %s event for %s, got %+v", store.AuditActionSessionCreated, userID, event)
+		}
+		if event.UserAgent != "audit-test" || event.RequestID == "" {
+			t.Errorf("expected user agent and request id to be recorded, got %+v", event)
+		}
+	})
+
+	t.Run("should only list own events", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/audit/events?subject_id="+adminID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, userID))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if strings.Contains(rr.Body.String(), adminID) || !strings.Contains(rr.Body.String(), userID) {
+			t.Errorf("expected only events of %s, got %q", userID, rr.Body.String())
+		}
+	})
+
+	t.Run("should require audit:read for all events", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/admin/audit/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, userID))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "audit:read"))
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if !strings.Contains(rr.Body.String(), adminID) || !strings.Contains(rr.Body.String(), userID) {
+			t.Errorf("expected events of all users, got %q", rr.Body.String())
+		}
+	})
+}
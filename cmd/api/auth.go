@@ -1,23 +1,51 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lostxs/BackDev-test/internal/geoip"
+	"github.com/lostxs/BackDev-test/internal/ippolicy"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/metrics"
 	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type CreateTokenResponse struct {
 	*store.User
 	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
 }
 
 type RefreshResponse struct {
 	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+}
+
+type accessTokenParams struct {
+	userID    string
+	ipAddress string
+	roles     []*store.Role
+	scope     []string
+	// clientID is the OAuth client the token is issued to, if any.
+	clientID string
+	// actorID is set when an admin impersonates userID, it ends up in the
+	// RFC 8693 "act" claim.
+	actorID        string
+	authentication authentication
 }
 
 func (a *app) createTokensHandler(w http.ResponseWriter, r *http.Request) {
@@ -27,22 +55,59 @@ func (a *app) createTokensHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ipAddress := r.RemoteAddr
+	clientID := r.URL.Query().Get("client_id")
+	if clientID != "" && !a.knownClient(clientID) {
+		a.badRequestException(w, r, fmt.Errorf("client_id is not registered"))
+		return
+	}
+
+	ipAddress := getClientIP(r)
 
 	user, err := a.getUser(r.Context(), userID)
 	if err != nil {
 		switch err {
 		case store.ErrInvalidUserID:
 			a.badRequestException(w, r, err)
-		case store.ErrUserNotFound:
+		case store.ErrUserNotFound, errUserDisabled:
 			a.unauthorizedException(w, r, err)
 		default:
 			a.internalServerException(w, r, err)
 		}
 		return
 	}
+	logging.With(r.Context(), "user_id", user.ID)
+
+	if !a.enforceIPAllowlist(w, r, user) {
+		return
+	}
+
+	previous, err := a.store.Sessions.GetByUserID(r.Context(), user.ID)
+	if err != nil && err != store.ErrSessionNotFound {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	notifications, ok := a.assessRisk(w, r, user, previous, false)
+	if !ok {
+		return
+	}
 
-	accessToken, err := a.createAccessToken(user.ID, ipAddress, a.config.auth.accessToken.exp)
+	roles, err := a.store.Roles.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	scope := grantScope(strings.Fields(r.URL.Query().Get("scope")), store.Permissions(roles))
+
+	accessToken, err := a.createAccessToken(accessTokenParams{
+		userID:         user.ID,
+		ipAddress:      ipAddress,
+		roles:          roles,
+		scope:          scope,
+		clientID:       clientID,
+		authentication: newAuthentication(),
+	}, a.config.auth.accessToken.exp)
 	if err != nil {
 		a.internalServerException(w, r, err)
 		return
@@ -54,7 +119,16 @@ func (a *app) createTokensHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash, err := hashValue(refreshToken)
+	hash, err := hashValue(r.Context(), refreshToken)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	hooks, err := a.webhookMessages(r.Context(), webhook.EventSessionCreated, map[string]any{
+		"user_id":    user.ID,
+		"ip_address": ipAddress,
+	})
 	if err != nil {
 		a.internalServerException(w, r, err)
 		return
@@ -63,24 +137,36 @@ func (a *app) createTokensHandler(w http.ResponseWriter, r *http.Request) {
 	session := &store.Session{
 		UserID:           user.ID,
 		RefreshTokenHash: string(hash),
+		IPAddress:        ipAddress,
+		Location:         a.locate(r, ipAddress),
 	}
-	if err := a.store.Sessions.Upsert(r.Context(), session); err != nil {
+	if err := a.store.Sessions.UpsertWithOutbox(r.Context(), session, append(notifications, hooks...)...); err != nil {
 		a.internalServerException(w, r, err)
 		return
 	}
+	logging.With(r.Context(), "session_id", session.ID)
+	a.rememberDevice(r, user.ID)
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionSessionCreated,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"scope": strings.Join(scope, " ")},
+	})
 
-	setCookie(w, "refresh_token", refreshToken, "/", true)
+	a.setRefreshCookie(w, r, refreshToken)
+	metrics.TokensIssued.WithLabelValues("create").Inc()
 
 	if err := a.jsonResponse(w, http.StatusOK, CreateTokenResponse{
 		User:        user,
 		AccessToken: accessToken,
+		Scope:       strings.Join(scope, " "),
 	}); err != nil {
 		a.internalServerException(w, r, err)
 	}
 }
 
 func (a *app) refreshTokensHandler(w http.ResponseWriter, r *http.Request) {
-	refreshCookie, err := r.Cookie("refresh_token")
+	refreshCookie, err := r.Cookie(a.config.auth.refreshCookie.name())
 	if err != nil || refreshCookie.Value == "" {
 		a.unauthorizedException(w, r, fmt.Errorf("refresh token not provided"))
 		return
@@ -88,14 +174,17 @@ func (a *app) refreshTokensHandler(w http.ResponseWriter, r *http.Request) {
 
 	refreshToken := refreshCookie.Value
 
-	newIPAddress := r.RemoteAddr
+	// AccessTokenMiddleware has already checked this address against the
+	// user's IP allowlists.
+	newIPAddress := getClientIP(r)
 
-	userID := r.Context().Value(userCtx).(*store.User).ID
+	userID := getUserFromContext(r).ID
 
 	session, err := a.store.Sessions.GetByUserID(r.Context(), userID)
 	if err != nil {
 		switch err {
 		case store.ErrSessionNotFound:
+			setFailureReason(r, metrics.ReasonNotFound)
 			a.unauthorizedException(w, r, err)
 		case store.ErrInvalidUserID:
 			a.badRequestException(w, r, err)
@@ -104,20 +193,106 @@ func (a *app) refreshTokensHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
-	if !compareHashAndValue(session.RefreshTokenHash, refreshToken) {
+	logging.With(r.Context(), "session_id", session.ID)
+
+	if !compareHashAndValue(r.Context(), session.RefreshTokenHash, refreshToken) {
+		// The access token is valid but the refresh token is not the current
+		// one, which is what a replayed, already rotated token looks like.
+		a.auditEvent(r, &store.AuditEvent{
+			Action:    store.AuditActionTokenReuseDetected,
+			SubjectID: userID,
+			Metadata:  map[string]any{"session_id": session.ID},
+		})
+		a.dispatchWebhook(r, webhook.EventTokenReuseDetected, map[string]any{
+			"user_id":    userID,
+			"session_id": session.ID,
+			"ip_address": newIPAddress,
+		})
+		setFailureReason(r, metrics.ReasonMismatch)
 		a.unauthorizedException(w, r, fmt.Errorf("refresh token mismatch"))
 		return
 	}
 
-	userEmail := r.Context().Value(userCtx).(*store.User).Email
-	tokenIPAddress := r.Context().Value(ipAddressCtx).(string)
+	user := getUserFromContext(r)
+	change := ipChange{
+		previousIP:       r.Context().Value(ipAddressCtx).(string),
+		newIP:            newIPAddress,
+		previousLocation: session.Location,
+		newLocation:      a.locate(r, newIPAddress),
+	}
+
+	travel, impossible := geoip.ImpossibleTravel(change.previousLocation, change.newLocation, time.Since(session.UpdatedAt), a.config.geoip.maxTravelSpeed)
+	if impossible {
+		change.travel = &travel
+	}
+
+	var notifications []*store.OutboxMessage
+	if impossible || !a.config.auth.ipChange.matcher.SameNetwork(change.previousIP, change.newIP) {
+		change.policy = a.ipChangePolicy(user)
+		if impossible {
+			change.policy = ippolicy.Stricter(change.policy, a.config.geoip.impossibleTravelPolicy)
+		}
+
+		a.auditEvent(r, &store.AuditEvent{
+			Action:    store.AuditActionIPChanged,
+			SubjectID: userID,
+			Metadata:  change.metadata(),
+		})
+		metrics.IPChangeAlerts.WithLabelValues(string(change.policy), strconv.FormatBool(impossible)).Inc()
+
+		if change.policy != ippolicy.Ignore {
+			notifications, err = a.ipChangeNotifications(r.Context(), user, change)
+			if err != nil {
+				a.internalServerException(w, r, err)
+				return
+			}
+		}
 
-	if tokenIPAddress != newIPAddress {
-		mockSendEmail(userEmail, "IP address mismatch", "your IP address has changed")
+		switch change.policy {
+		case ippolicy.Deny:
+			a.enqueue(r, notifications)
+			setFailureReason(r, metrics.ReasonIPChange)
+			a.forbiddenException(w, r, errIPChangeDenied)
+			return
+		case ippolicy.RequireReauth:
+			if err := a.store.Sessions.DeleteByUserID(r.Context(), userID); err != nil && err != store.ErrSessionNotFound {
+				a.internalServerException(w, r, err)
+				return
+			}
+			a.enqueue(r, notifications)
+			setFailureReason(r, metrics.ReasonIPChange)
+			a.unauthorizedException(w, r, errReauthRequired)
+			return
+		}
+	}
+
+	risky, ok := a.assessRisk(w, r, user, session, true)
+	if !ok {
+		return
+	}
+	notifications = append(notifications, risky...)
+
+	roles, err := a.store.Roles.GetByUserID(r.Context(), session.UserID)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
 	}
 
-	newAccessToken, err := a.createAccessToken(session.UserID, newIPAddress, a.config.auth.accessToken.exp)
+	// A refreshed token never widens the scope, and drops anything the user
+	// has lost since the previous token was issued. An empty scope stays
+	// empty.
+	tokenScope, _ := r.Context().Value(scopeCtx).([]string)
+	scope := intersectScope(tokenScope, store.Permissions(roles))
+
+	newAccessToken, err := a.createAccessToken(accessTokenParams{
+		userID:    session.UserID,
+		ipAddress: newIPAddress,
+		roles:     roles,
+		scope:     scope,
+		clientID:  getClientFromContext(r),
+		// A refresh is not a new authentication, auth_time and acr carry over.
+		authentication: getAuthenticationFromContext(r),
+	}, a.config.auth.accessToken.exp)
 	if err != nil {
 		a.internalServerException(w, r, err)
 		return
@@ -129,42 +304,230 @@ func (a *app) refreshTokensHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash, err := hashValue(newRefreshToken)
+	hash, err := hashValue(r.Context(), newRefreshToken)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	hooks, err := a.webhookMessages(r.Context(), webhook.EventSessionRefreshed, map[string]any{
+		"user_id":    userID,
+		"session_id": session.ID,
+		"ip_address": newIPAddress,
+	})
 	if err != nil {
 		a.internalServerException(w, r, err)
 		return
 	}
+	notifications = append(notifications, hooks...)
 
 	session.RefreshTokenHash = string(hash)
-	if err := a.store.Sessions.Upsert(r.Context(), session); err != nil {
+	session.IPAddress = newIPAddress
+	session.Location = change.newLocation
+	if err := a.store.Sessions.UpsertWithOutbox(r.Context(), session, notifications...); err != nil {
 		a.internalServerException(w, r, err)
 		return
 	}
+	a.rememberDevice(r, userID)
 
-	setCookie(w, "refresh_token", newRefreshToken, "/", true)
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionSessionRefreshed,
+		SubjectID: userID,
+		Metadata:  map[string]any{"session_id": session.ID},
+	})
+
+	a.setRefreshCookie(w, r, newRefreshToken)
+	metrics.TokensIssued.WithLabelValues("refresh").Inc()
 
 	if err := a.jsonResponse(w, http.StatusOK, RefreshResponse{
 		AccessToken: newAccessToken,
+		Scope:       strings.Join(scope, " "),
 	}); err != nil {
 		a.internalServerException(w, r, err)
 	}
 }
 
-func (a *app) createAccessToken(userID string, ipAddress string, exp time.Duration) (string, error) {
+func (a *app) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	userID := getUserFromContext(r).ID
+
+	if err := a.store.Sessions.DeleteByUserID(r.Context(), userID); err != nil && err != store.ErrSessionNotFound {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionSessionLoggedOut,
+		SubjectID: userID,
+	})
+
+	a.clearRefreshCookie(w, r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) createAccessToken(params accessTokenParams, exp time.Duration) (string, error) {
+	roleNames := make([]string, 0, len(params.roles))
+	for _, role := range params.roles {
+		roleNames = append(roleNames, role.Name)
+	}
+
 	accessClaims := jwt.MapClaims{
-		"sub":        userID,
-		"ip_address": ipAddress,
-		"exp":        time.Now().Add(exp).Unix(),
+		"sub":         params.userID,
+		"ip_address":  params.ipAddress,
+		"roles":       roleNames,
+		"permissions": store.Permissions(params.roles),
+		"scope":       strings.Join(params.scope, " "),
+		"exp":         time.Now().Add(exp).Unix(),
 	}
 
+	// RFC 9068 names the client the token was issued to.
+	if params.clientID != "" {
+		accessClaims["client_id"] = params.clientID
+	}
+	if params.actorID != "" {
+		accessClaims["act"] = map[string]string{"sub": params.actorID}
+	}
+	params.authentication.claims(accessClaims)
+
 	return a.authenticator.GenerateAccessToken(accessClaims)
 }
 
-func mockSendEmail(to, subject, body string) {
-	log.Printf("mock email sent to %s:\nSubject: %s\nBody: %s", to, subject, body)
+// grantScope intersects the requested scopes with the allowed ones. An empty
+// request grants everything that is allowed. Only the user's roles limit the
+// scope, registered clients carry no scopes to intersect with.
+func grantScope(requested, allowed []string) []string {
+	if len(requested) == 0 {
+		return allowed
+	}
+	return intersectScope(requested, allowed)
+}
+
+func (a *app) knownClient(clientID string) bool {
+	return slices.Contains(a.config.auth.clients, clientID)
+}
+
+// intersectScope keeps the scopes that are also allowed.
+func intersectScope(requested, allowed []string) []string {
+	granted := []string{}
+	for _, scope := range requested {
+		if slices.Contains(allowed, scope) && !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return granted
 }
 
-func hashValue(value string) (string, error) {
+var (
+	errIPChangeDenied = errors.New("refresh from a new network is not allowed")
+	errReauthRequired = errors.New("reauthentication required")
+)
+
+// ipChangePolicy returns the user's policy, falling back to the global one.
+func (a *app) ipChangePolicy(user *store.User) ippolicy.Policy {
+	if policy, err := ippolicy.Parse(user.IPChangePolicy); err == nil {
+		return policy
+	}
+	if a.config.auth.ipChange.policy != "" {
+		return a.config.auth.ipChange.policy
+	}
+	return ippolicy.Notify
+}
+
+// ipChange describes a refresh from another network or an impossible
+// distance away from the previous one.
+type ipChange struct {
+	previousIP       string
+	newIP            string
+	previousLocation *geoip.Location
+	newLocation      *geoip.Location
+	// travel is set when the travel speed exceeds the configured maximum.
+	travel *geoip.Travel
+	policy ippolicy.Policy
+}
+
+func (c ipChange) metadata() map[string]any {
+	metadata := map[string]any{
+		"previous_ip": c.previousIP,
+		"new_ip":      c.newIP,
+		"decision":    string(c.policy),
+	}
+	if c.previousLocation != nil {
+		metadata["previous_location"] = c.previousLocation
+	}
+	if c.newLocation != nil {
+		metadata["new_location"] = c.newLocation
+	}
+	if c.travel != nil {
+		metadata["impossible_travel"] = c.travel
+	}
+	return metadata
+}
+
+func (a *app) ipChangeNotifications(ctx context.Context, user *store.User, change ipChange) ([]*store.OutboxMessage, error) {
+	email, err := a.emailNotification(user, mailer.TemplateIPChanged, ipChangedEmailData{
+		Email:            user.Email,
+		PreviousIP:       change.previousIP,
+		NewIP:            change.newIP,
+		PreviousLocation: change.previousLocation,
+		NewLocation:      change.newLocation,
+		ImpossibleTravel: change.travel != nil,
+		Time:             time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := change.metadata()
+	data["user_id"] = user.ID
+
+	hooks, err := a.webhookMessages(ctx, webhook.EventIPChanged, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*store.OutboxMessage{email}, hooks...), nil
+}
+
+type ipChangedEmailData struct {
+	Email            string
+	PreviousIP       string
+	NewIP            string
+	PreviousLocation *geoip.Location
+	NewLocation      *geoip.Location
+	ImpossibleTravel bool
+	Time             time.Time
+}
+
+// emailNotification renders the template in the user's locale and wraps it
+// into an outbox message, delivery happens in the outbox worker so the
+// request never waits for the mail server.
+func (a *app) emailNotification(user *store.User, template string, data any) (*store.OutboxMessage, error) {
+	msg, err := a.templates.Render(template, user.Locale, data)
+	if err != nil {
+		return nil, err
+	}
+	msg.To = []string{user.Email}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.OutboxMessage{
+		IdempotencyKey: template + "." + uuid.NewString(),
+		Kind:           store.OutboxKindEmail,
+		Payload:        payload,
+	}, nil
+}
+
+func hashValue(ctx context.Context, value string) (string, error) {
+	_, span := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
+	timer := prometheus.NewTimer(metrics.BcryptDuration)
+	defer timer.ObserveDuration()
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
@@ -172,15 +535,9 @@ func hashValue(value string) (string, error) {
 	return string(hash), nil
 }
 
-func compareHashAndValue(hash, value string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(value)) == nil
-}
+func compareHashAndValue(ctx context.Context, hash, value string) bool {
+	_, span := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
 
-func setCookie(w http.ResponseWriter, name, value string, path string, httpOnly bool) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
-		Value:    value,
-		Path:     path,
-		HttpOnly: httpOnly,
-	})
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(value)) == nil
 }
@@ -2,13 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/lostxs/BackDev-test/internal/auth"
+	"github.com/lostxs/BackDev-test/internal/geoip"
+	"github.com/lostxs/BackDev-test/internal/ippolicy"
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/outbox"
 	"github.com/lostxs/BackDev-test/internal/store"
 )
 
@@ -96,7 +105,7 @@ func TestCreateTokensHandler(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		hash, err := hashValue(testRefreshToken)
+		hash, err := hashValue(context.Background(), testRefreshToken)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -129,12 +138,18 @@ func TestCreateTokensHandler(t *testing.T) {
 		if refreshTokenCookie == nil {
 			t.Fatalf("expected refresh_token cookie to be set")
 		}
-		if refreshTokenCookie.Path != "/" {
-			t.Errorf("expected refresh_token cookie Path to be '/', got %q", refreshTokenCookie.Path)
+		if refreshTokenCookie.Path != refreshPath {
+			t.Errorf("expected refresh_token cookie Path to be %q, got %q", refreshPath, refreshTokenCookie.Path)
+		}
+		if refreshTokenCookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("expected refresh_token cookie SameSite to be Strict, got %v", refreshTokenCookie.SameSite)
 		}
 		if !refreshTokenCookie.HttpOnly {
 			t.Errorf("expected refresh_token cookie HttpOnly to be true")
 		}
+		if refreshTokenCookie.Secure {
+			t.Errorf("expected refresh_token cookie not to be Secure over plain HTTP")
+		}
 	})
 
 	t.Run("should return valid JSON response", func(t *testing.T) {
@@ -166,6 +181,23 @@ func TestCreateTokensHandler(t *testing.T) {
 		rr := executeRequest(req, mux)
 		checkResponseCode(t, http.StatusOK, rr.Code)
 	})
+
+	t.Run("should only grant allowed scopes", func(t *testing.T) {
+		app.store.Roles.AssignToUser(context.Background(), nil, "86990727-379a-42ea-a71d-69179969e777", "admin")
+
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id=86990727-379a-42ea-a71d-69179969e777&scope=users:read+billing:write", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		expected := `"scope":"users:read"`
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected JSON response to contain %q, got %q", expected, rr.Body.String())
+		}
+	})
 }
 
 func TestRefreshHandler(t *testing.T) {
@@ -201,7 +233,7 @@ func TestRefreshHandler(t *testing.T) {
 	mux := app.mount()
 
 	t.Run("should return 401 authorization header is missing", func(t *testing.T) {
-		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -211,7 +243,7 @@ func TestRefreshHandler(t *testing.T) {
 	})
 
 	t.Run("should return 401 if access token is invalid", func(t *testing.T) {
-		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -223,7 +255,7 @@ func TestRefreshHandler(t *testing.T) {
 	})
 
 	t.Run("should return 401 if refresh token is not provided", func(t *testing.T) {
-		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -240,7 +272,7 @@ func TestRefreshHandler(t *testing.T) {
 	})
 
 	t.Run("should return 401 if session not found", func(t *testing.T) {
-		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -262,12 +294,445 @@ func TestRefreshHandler(t *testing.T) {
 		}
 	})
 
+	t.Run("should send email if ip address changed", func(t *testing.T) {
+		mockSessionStore.Upsert(context.Background(), &store.Session{
+			ID:               "ce2c7489-837a-4910-84b8-cff4e70248a5",
+			UserID:           "86990727-379a-42ea-a71d-69179969e777",
+			RefreshTokenHash: hashValueOrFail("valid-refresh-token"),
+		})
+
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = "10.0.0.1:8080"
+		req.Header.Set("Authorization", "Bearer "+testAccessToken)
+		req.AddCookie(&http.Cookie{
+			Name:  "refresh_token",
+			Value: "valid-refresh-token",
+		})
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		worker := outbox.NewWorker(app.store.Outbox, app.mailer, outbox.Config{BatchSize: 10, MaxAttempts: 1})
+		if n, err := worker.ProcessDue(context.Background()); err != nil || n != 1 {
+			t.Fatalf("expected one outbox message to be delivered, got %d: %v", n, err)
+		}
+
+		messages := app.mailer.(*mailer.MemoryMailer).Messages()
+		if len(messages) != 1 || messages[0].To[0] != "test@test.com" {
+			t.Fatalf("expected one email to test@test.com, got %+v", messages)
+		}
+		if !strings.Contains(messages[0].Text, "10.0.0.1") || strings.Contains(messages[0].Text, "10.0.0.1:8080") || messages[0].HTML == "" {
+			t.Errorf("expected text and html parts with the new ip, got %+v", messages[0])
+		}
+	})
+}
+
+func TestIPChangePolicy(t *testing.T) {
+	cfg := config{
+		auth: authConfig{
+			ipChange: ipChangeConfig{
+				policy:  ippolicy.Deny,
+				matcher: ippolicy.Matcher{IPv4Prefix: 24, IPv6Prefix: 56},
+			},
+		},
+	}
+
+	app := newTestApplication(t, cfg)
+
+	user := &store.User{
+		ID:    "86990727-379a-42ea-a71d-69179969e777",
+		Email: "test@test.com",
+	}
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, user)
+
+	testAccessToken := newTestAccessToken(t, app, user.ID)
+	mux := app.mount()
+
+	refresh := func(remoteAddr string) int {
+		app.store.Sessions.Upsert(context.Background(), &store.Session{
+			ID:               "ce2c7489-837a-4910-84b8-cff4e70248a5",
+			UserID:           user.ID,
+			RefreshTokenHash: hashValueOrFail("valid-refresh-token"),
+		})
+
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+testAccessToken)
+		req.AddCookie(&http.Cookie{
+			Name:  "refresh_token",
+			Value: "valid-refresh-token",
+		})
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should allow refresh within the same network", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, refresh("127.0.0.42:9000"))
+	})
+
+	t.Run("should deny refresh from another network", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, refresh("10.0.0.1:8080"))
+
+		if _, err := app.store.Sessions.GetByUserID(context.Background(), user.ID); err != nil {
+			t.Errorf("expected session to be kept, got %v", err)
+		}
+
+		events := app.store.Audit.(*store.MockAuditStore).Events
+		last := events[len(events)-1]
+		if last.Action != store.AuditActionIPChanged || last.Metadata["decision"] != string(ippolicy.Deny) {
+			t.Errorf("expected ip.changed with deny decision, got %+v", last)
+		}
+	})
+
+	t.Run("should require reauthentication with user policy", func(t *testing.T) {
+		user.IPChangePolicy = string(ippolicy.RequireReauth)
+		defer func() { user.IPChangePolicy = "" }()
+
+		checkResponseCode(t, http.StatusUnauthorized, refresh("10.0.0.1:8080"))
+
+		if _, err := app.store.Sessions.GetByUserID(context.Background(), user.ID); err != store.ErrSessionNotFound {
+			t.Errorf("expected session to be deleted, got %v", err)
+		}
+	})
+}
+
+// staticLocator serves locations from a map keyed by IP address.
+type staticLocator map[string]*geoip.Location
+
+func (s staticLocator) Lookup(ip string) (*geoip.Location, error) {
+	return s[ip], nil
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	cfg := config{
+		auth: authConfig{
+			ipChange: ipChangeConfig{
+				matcher: ippolicy.Matcher{IPv4Prefix: 24},
+			},
+		},
+		geoip: geoipConfig{
+			maxTravelSpeed:         1000,
+			impossibleTravelPolicy: ippolicy.Deny,
+		},
+	}
+
+	app := newTestApplication(t, cfg)
+
+	berlin := &geoip.Location{Country: "DE", City: "Berlin", Coordinates: &geoip.Coordinates{Latitude: 52.52, Longitude: 13.40, AccuracyRadius: 20}}
+	newYork := &geoip.Location{Country: "US", City: "New York", Coordinates: &geoip.Coordinates{Latitude: 40.71, Longitude: -74.01, AccuracyRadius: 20}}
+	app.geo = staticLocator{"127.0.0.1": berlin, "127.0.0.2": newYork}
+
+	user := &store.User{
+		ID:    "86990727-379a-42ea-a71d-69179969e777",
+		Email: "test@test.com",
+	}
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, user)
+
+	testAccessToken := newTestAccessToken(t, app, user.ID)
+	mux := app.mount()
+
+	refresh := func(lastRefresh time.Time) *httptest.ResponseRecorder {
+		session := &store.Session{
+			ID:               "ce2c7489-837a-4910-84b8-cff4e70248a5",
+			UserID:           user.ID,
+			RefreshTokenHash: hashValueOrFail("valid-refresh-token"),
+			Location:         berlin,
+		}
+		app.store.Sessions.Upsert(context.Background(), session)
+		session.UpdatedAt = lastRefresh
+
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = "127.0.0.2:8080"
+		req.Header.Set("Authorization", "Bearer "+testAccessToken)
+		req.AddCookie(&http.Cookie{
+			Name:  "refresh_token",
+			Value: "valid-refresh-token",
+		})
+
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should allow travel at a possible speed", func(t *testing.T) {
+		rr := refresh(time.Now().Add(-24 * time.Hour))
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		session, err := app.store.Sessions.GetByUserID(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Location != newYork {
+			t.Errorf("expected session location to be updated, got %+v", session.Location)
+		}
+	})
+
+	t.Run("should apply impossible travel policy", func(t *testing.T) {
+		rr := refresh(time.Now().Add(-time.Hour))
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+
+		events := app.store.Audit.(*store.MockAuditStore).Events
+		last := events[len(events)-1]
+		if last.Action != store.AuditActionIPChanged || last.Metadata["impossible_travel"] == nil {
+			t.Fatalf("expected ip.changed with impossible travel, got %+v", last)
+		}
+		if last.Location != newYork {
+			t.Errorf("expected audit event location %+v, got %+v", newYork, last.Location)
+		}
+	})
+}
+
+func TestEmailNotificationLocale(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	data := ipChangedEmailData{
+		Email:      "test@test.com",
+		PreviousIP: "127.0.0.1",
+		NewIP:      "10.0.0.1",
+		Time:       time.Now(),
+	}
+
+	for locale, subject := range map[string]string{
+		"ru-RU": "Вход с нового IP адреса",
+		"de":    "New sign-in IP address",
+	} {
+		notification, err := app.emailNotification(&store.User{Email: "test@test.com", Locale: locale}, mailer.TemplateIPChanged, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var msg mailer.Message
+		if err := json.Unmarshal(notification.Payload, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != subject {
+			t.Errorf("expected subject %q for locale %q, got %q", subject, locale, msg.Subject)
+		}
+
+		body, err := msg.Bytes("no-reply@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(body), "multipart/alternative") {
+			t.Errorf("expected multipart email, got %q", body)
+		}
+	}
 }
 
 func hashValueOrFail(value string) string {
-	hash, err := hashValue(value)
+	hash, err := hashValue(context.Background(), value)
 	if err != nil {
 		panic(err)
 	}
 	return string(hash)
 }
+
+func TestRefreshScope(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{accessToken: accessTokenConfig{exp: time.Hour}},
+	})
+
+	const userID = "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+	app.store.Roles.AssignToUser(context.Background(), nil, userID, "admin")
+
+	mux := app.mount()
+
+	tests := []struct {
+		name      string
+		requested string
+		expected  string
+	}{
+		{"should keep a disjoint scope empty", "billing:write", ""},
+		{"should keep the granted scope", "users:read billing:write", "users:read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID+"&scope="+url.QueryEscape(tt.requested), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+
+			var issued struct {
+				Data CreateTokenResponse `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&issued); err != nil {
+				t.Fatal(err)
+			}
+			if issued.Data.Scope != tt.expected {
+				t.Fatalf("expected issued scope %q, got %q", tt.expected, issued.Data.Scope)
+			}
+
+			req, err = http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+issued.Data.AccessToken)
+			for _, cookie := range rr.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+
+			rr = executeRequest(req, mux)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+
+			var refreshed struct {
+				Data RefreshResponse `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&refreshed); err != nil {
+				t.Fatal(err)
+			}
+			if refreshed.Data.Scope != tt.expected {
+				t.Errorf("expected refreshed scope %q, got %q", tt.expected, refreshed.Data.Scope)
+			}
+		})
+	}
+}
+
+func TestClientID(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{
+			accessToken: accessTokenConfig{exp: time.Hour},
+			clients:     []string{"spa"},
+		},
+	})
+
+	const userID = "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	mux := app.mount()
+
+	clientClaim := func(t *testing.T, token string) any {
+		t.Helper()
+
+		jwtToken, err := app.authenticator.ValidateAccessToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jwtToken.Claims.(jwt.MapClaims)["client_id"]
+	}
+
+	t.Run("should reject an unregistered client", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID+"&client_id=unknown", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should keep the client across refresh", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID+"&client_id=spa", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var issued struct {
+			Data CreateTokenResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&issued); err != nil {
+			t.Fatal(err)
+		}
+		if got := clientClaim(t, issued.Data.AccessToken); got != "spa" {
+			t.Fatalf("expected client_id claim spa, got %v", got)
+		}
+
+		req, err = http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+issued.Data.AccessToken)
+		for _, cookie := range rr.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var refreshed struct {
+			Data RefreshResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&refreshed); err != nil {
+			t.Fatal(err)
+		}
+		if got := clientClaim(t, refreshed.Data.AccessToken); got != "spa" {
+			t.Errorf("expected refreshed client_id claim spa, got %v", got)
+		}
+	})
+}
+
+func TestMailTemplatesOverride(t *testing.T) {
+	t.Run("should render an override", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "de/lockout.txt", `{{define "subject"}}Konto gesperrt{{end}}{{define "body"}}{{.Email}}{{end}}`)
+
+		templates, err := mailer.NewTemplates(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := templates.Render(mailer.TemplateLockout, "de-DE", map[string]any{"Email": "test@test.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != "Konto gesperrt" || msg.HTML != "" {
+			t.Errorf("expected text-only override, got %+v", msg)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		file     string
+		template string
+	}{
+		{"should fail on a syntax error", "en/lockout.txt", `{{define "subject"}}{{.Email}{{end}}`},
+		{"should fail without a subject", "ru/lockout.txt", `{{define "body"}}{{.Email}}{{end}}`},
+		{"should fail on an unknown template", "en/lockuot.txt", `{{define "subject"}}{{end}}{{define "body"}}{{end}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplate(t, dir, tt.file, tt.template)
+
+			if _, err := mailer.NewTemplates(dir); err == nil {
+				t.Error("expected templates to be refused at startup")
+			}
+		})
+	}
+}
+
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
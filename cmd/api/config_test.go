@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/env"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func lookupEnv(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestLoader(t *testing.T, args []string, vars map[string]string) *env.Loader {
+	t.Helper()
+
+	loader, err := env.NewLoader(args, lookupEnv(vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loader
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("should layer file, env and flags", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", `
+app:
+  addr: ":9000"
+access_token:
+  exp: 1m
+impersonation_token:
+  exp: 1m
+db:
+  max_open_conns: 3
+geoip:
+  databases: [a.mmdb, b.mmdb]
+`)
+
+		cfg, err := loadConfig(newTestLoader(t,
+			[]string{"--config-file=" + path, "--access-token-exp=3m"},
+			map[string]string{
+				"ACCESS_TOKEN_EXP":        "2m",
+				"IMPERSONATION_TOKEN_EXP": "2m",
+				"ACCESS_TOKEN_SECRET":     testSecret,
+			},
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.addr != ":9000" || cfg.db.maxOpenConns != 3 {
+			t.Errorf("expected file settings, got addr %q and %d connections", cfg.addr, cfg.db.maxOpenConns)
+		}
+		if cfg.auth.impersonation.exp != 2*time.Minute {
+			t.Errorf("expected env to override the file, got %v", cfg.auth.impersonation.exp)
+		}
+		if cfg.auth.accessToken.exp != 3*time.Minute {
+			t.Errorf("expected flag to override env, got %v", cfg.auth.accessToken.exp)
+		}
+		if strings.Join(cfg.geoip.databases, ",") != "a.mmdb,b.mmdb" {
+			t.Errorf("expected list from file, got %v", cfg.geoip.databases)
+		}
+	})
+
+	t.Run("should read toml files", func(t *testing.T) {
+		path := writeConfigFile(t, "config.toml", `
+[smtp]
+port = 2525
+require_tls = false
+`)
+
+		cfg, err := loadConfig(newTestLoader(t, nil, map[string]string{
+			"CONFIG_FILE":         path,
+			"ACCESS_TOKEN_SECRET": testSecret,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.mailer.smtp.Port != 2525 || cfg.mailer.smtp.RequireTLS {
+			t.Errorf("expected smtp settings from file, got %+v", cfg.mailer.smtp)
+		}
+	})
+
+	t.Run("should report every invalid setting", func(t *testing.T) {
+		_, err := loadConfig(newTestLoader(t, []string{"--acces-token-exp=1m"}, map[string]string{
+			"ACCESS_TOKEN_EXP":   "15minutes",
+			"SMTP_PORT":          "70000",
+			"MAILER":             "sendmail",
+			"MAIL_FROM":          "no-reply",
+			"RATE_LIMIT_TOKENS":  "ip:20/1m,user:10/1m",
+			"RATE_LIMIT_REFRESH": "ip:60/1m,device:600/1m",
+			"OAUTH_CLIENTS":      "spa,my app",
+			"CORS_ROUTES":        "/api/auth/refresh POST credentials,/api/auth/tokens FETCH",
+			"OUTBOX_LEASE":       "10s",
+		}))
+		if err == nil {
+			t.Fatal("expected configuration to be invalid")
+		}
+
+		for _, want := range []string{
+			`ACCESS_TOKEN_EXP (env): invalid value "15minutes"`,
+			"SMTP_PORT (env): must be between 1 and 65535",
+			`MAILER (env): must be one of smtp, log, got "sendmail"`,
+			`MAIL_FROM (env): invalid address "no-reply"`,
+			"RATE_LIMIT_TOKENS (env): the user key only applies to authenticated routes",
+			`RATE_LIMIT_REFRESH (env): unknown key "device"`,
+			`OAUTH_CLIENTS (env): invalid client id "my app"`,
+			`CORS_ROUTES (env): invalid route "/api/auth/tokens FETCH", unknown method or option "FETCH"`,
+			"OUTBOX_LEASE (env): must exceed SMTP_TIMEOUT and WEBHOOK_TIMEOUT",
+			"ACCESS_TOKEN_SECRET (default): must be set",
+			"ACCES_TOKEN_EXP (flag): unknown setting",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error to contain %q, got:\n%v", want, err)
+			}
+		}
+	})
+
+	t.Run("should refuse default secrets outside development", func(t *testing.T) {
+		vars := map[string]string{"ACCESS_TOKEN_SECRET": devAccessTokenSecret}
+
+		if _, err := loadConfig(newTestLoader(t, nil, vars)); err == nil || !strings.Contains(err.Error(), "well-known default") {
+			t.Errorf("expected default secret to be refused, got %v", err)
+		}
+
+		vars["APP_ENV"] = environmentDevelopment
+		if _, err := loadConfig(newTestLoader(t, nil, vars)); err != nil {
+			t.Errorf("expected default secret in development, got %v", err)
+		}
+	})
+
+	t.Run("should redact secrets when printing", func(t *testing.T) {
+		loader := newTestLoader(t, []string{"--print-config"}, map[string]string{
+			"ACCESS_TOKEN_SECRET": testSecret,
+			"SMTP_PASSWORD":       "smtp-password",
+			"DATABASE_URI":        "postgres://backdev:db-password@db:5432/backdev",
+		})
+		if !loader.Flag("print-config") {
+			t.Fatal("expected print-config flag")
+		}
+		if _, err := loadConfig(loader); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := loader.Print(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, secret := range []string{testSecret, "smtp-password", "db-password"} {
+			if strings.Contains(out.String(), secret) {
+				t.Errorf("expected %q to be redacted, got:\n%s", secret, out.String())
+			}
+		}
+		if !strings.Contains(out.String(), `ACCESS_TOKEN_EXP="15m0s" # default`) {
+			t.Errorf("expected defaults with their source, got:\n%s", out.String())
+		}
+		if strings.Contains(out.String(), "PRINT_CONFIG") {
+			t.Errorf("expected command flags not to be printed, got:\n%s", out.String())
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	refreshCookieName = "refresh_token"
+	// refreshPath is the only path the browser sends the refresh cookie to.
+	refreshPath = "/api/auth/refresh"
+)
+
+// Cookie name prefixes, browsers only accept a __Secure- cookie with Secure
+// and a __Host- cookie with Secure, Path=/ and no Domain.
+const (
+	cookiePrefixSecure = "__Secure-"
+	cookiePrefixHost   = "__Host-"
+)
+
+const (
+	cookieSecureAuto   = "auto"
+	cookieSecureAlways = "always"
+	cookieSecureNever  = "never"
+)
+
+// refreshCookieConfig is the policy of the refresh token cookie, the zero
+// value is SameSite=Strict, scoped to refreshPath and Secure over TLS.
+type refreshCookieConfig struct {
+	// prefix is empty, __Secure- or __Host-.
+	prefix string
+	domain string
+	// sameSite defaults to Strict.
+	sameSite http.SameSite
+	// secure is auto, always or never, auto marks the cookie Secure when the
+	// request came over TLS.
+	secure string
+}
+
+func (c refreshCookieConfig) name() string {
+	return c.prefix + refreshCookieName
+}
+
+// path is refreshPath, except for __Host- cookies which must be sent to every
+// path.
+func (c refreshCookieConfig) path() string {
+	if c.prefix == cookiePrefixHost {
+		return "/"
+	}
+	return refreshPath
+}
+
+func (c refreshCookieConfig) isSecure(r *http.Request) bool {
+	switch {
+	case c.prefix != "", c.secure == cookieSecureAlways:
+		return true
+	case c.secure == cookieSecureNever:
+		return false
+	default:
+		return r.TLS != nil
+	}
+}
+
+func (c refreshCookieConfig) cookie(r *http.Request, value string) *http.Cookie {
+	sameSite := c.sameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteStrictMode
+	}
+
+	return &http.Cookie{
+		Name:     c.name(),
+		Value:    value,
+		Path:     c.path(),
+		Domain:   c.domain,
+		HttpOnly: true,
+		Secure:   c.isSecure(r),
+		SameSite: sameSite,
+	}
+}
+
+func (a *app) setRefreshCookie(w http.ResponseWriter, r *http.Request, refreshToken string) {
+	http.SetCookie(w, a.config.auth.refreshCookie.cookie(r, refreshToken))
+}
+
+func (a *app) clearRefreshCookie(w http.ResponseWriter, r *http.Request) {
+	cookie := a.config.auth.refreshCookie.cookie(r, "")
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+func parseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite %q, use strict, lax or none", s)
+	}
+}
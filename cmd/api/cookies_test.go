@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+)
+
+type cookieAttributes struct {
+	Name     string
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func TestRefreshCookie(t *testing.T) {
+	plain, err := http.NewRequest(http.MethodGet, "/api/auth/tokens", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure := plain.Clone(plain.Context())
+	secure.TLS = &tls.ConnectionState{}
+
+	tests := []struct {
+		name     string
+		config   refreshCookieConfig
+		r        *http.Request
+		expected cookieAttributes
+	}{
+		{
+			"should default to a strict cookie scoped to the refresh path",
+			refreshCookieConfig{},
+			plain,
+			cookieAttributes{Name: "refresh_token", Path: refreshPath, SameSite: http.SameSiteStrictMode},
+		},
+		{
+			"should be secure over TLS",
+			refreshCookieConfig{secure: cookieSecureAuto},
+			secure,
+			cookieAttributes{Name: "refresh_token", Path: refreshPath, Secure: true, SameSite: http.SameSiteStrictMode},
+		},
+		{
+			"should be secure behind a TLS terminating proxy",
+			refreshCookieConfig{secure: cookieSecureAlways, domain: "example.com", sameSite: http.SameSiteLaxMode},
+			plain,
+			cookieAttributes{Name: "refresh_token", Path: refreshPath, Domain: "example.com", Secure: true, SameSite: http.SameSiteLaxMode},
+		},
+		{
+			"should keep the path with the __Secure- prefix",
+			refreshCookieConfig{prefix: cookiePrefixSecure},
+			plain,
+			cookieAttributes{Name: "__Secure-refresh_token", Path: refreshPath, Secure: true, SameSite: http.SameSiteStrictMode},
+		},
+		{
+			"should use the root path with the __Host- prefix",
+			refreshCookieConfig{prefix: cookiePrefixHost},
+			plain,
+			cookieAttributes{Name: "__Host-refresh_token", Path: "/", Secure: true, SameSite: http.SameSiteStrictMode},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie := tt.config.cookie(tt.r, "token")
+			if !cookie.HttpOnly {
+				t.Errorf("expected cookie to be HttpOnly")
+			}
+
+			got := cookieAttributes{
+				Name:     cookie.Name,
+				Path:     cookie.Path,
+				Domain:   cookie.Domain,
+				Secure:   cookie.Secure,
+				SameSite: cookie.SameSite,
+			}
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
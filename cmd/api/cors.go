@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lostxs/BackDev-test/internal/cors"
+)
+
+const (
+	tokensPath = "/api/auth/tokens"
+	logoutPath = "/api/auth/logout"
+)
+
+// defaultCORSRoutes allow credentials only on the endpoints that set, read
+// or clear the refresh cookie, the rest of the API is authenticated by the
+// Authorization header. Without credentials the browser would drop the
+// cookie set by token issuance.
+var defaultCORSRoutes = strings.Join([]string{
+	tokensPath + " GET credentials",
+	refreshPath + " POST credentials",
+	logoutPath + " POST credentials",
+}, ",")
+
+// newCORS returns nil when no origin is allowed. A route allows credentials
+// only when CORS_ALLOW_CREDENTIALS does too.
+func newCORS(cfg corsConfig) (*cors.CORS, error) {
+	if cfg.origins.Empty() {
+		return nil, nil
+	}
+
+	// Methods covers every method the API routes, the admin API updates
+	// with PUT.
+	policy := cors.Policy{
+		Origins:        cfg.origins,
+		Methods:        []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		Headers:        cfg.headers,
+		ExposedHeaders: cfg.exposedHeaders,
+		MaxAge:         cfg.maxAge,
+	}
+
+	overrides := make(map[string]cors.Policy, len(cfg.routes))
+	for _, route := range cfg.routes {
+		override := policy
+		override.Methods = route.Methods
+		override.Credentials = route.Credentials && cfg.credentials
+		overrides[route.Path] = override
+	}
+
+	return cors.New(policy, overrides)
+}
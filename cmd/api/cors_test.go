@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/cors"
+)
+
+func newTestCORS(t *testing.T, origins ...string) corsConfig {
+	t.Helper()
+
+	parsed, err := cors.ParseOrigins(origins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := cors.ParseRoutes(strings.Split(defaultCORSRoutes, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return corsConfig{
+		origins:        parsed,
+		routes:         routes,
+		headers:        []string{"Authorization", "Content-Type"},
+		exposedHeaders: []string{"Retry-After"},
+		credentials:    true,
+		maxAge:         10 * time.Minute,
+	}
+}
+
+func TestCORS(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	var err error
+	app.cors, err = newCORS(newTestCORS(t, "https://app.example.com", "https://*.preview.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := app.mount()
+
+	preflight := func(t *testing.T, path, origin, method string) http.Header {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodOptions, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", "authorization")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+		return rr.Header()
+	}
+
+	t.Run("should allow credentials on the refresh endpoint", func(t *testing.T) {
+		h := preflight(t, refreshPath, "https://app.example.com", http.MethodPost)
+
+		if got := h.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("expected origin to be allowed, got %q", got)
+		}
+		if got := h.Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("expected credentials to be allowed, got %q", got)
+		}
+		if got := h.Get("Access-Control-Allow-Headers"); got != "authorization" {
+			t.Errorf("expected authorization header to be allowed, got %q", got)
+		}
+		if got := h.Get("Access-Control-Max-Age"); got != "600" {
+			t.Errorf("expected preflight to be cached for 600 seconds, got %q", got)
+		}
+	})
+
+	t.Run("should allow PUT on the admin API", func(t *testing.T) {
+		h := preflight(t, "/api/admin/users/86990727-379a-42ea-a71d-69179969e777/organization", "https://app.example.com", http.MethodPut)
+
+		if got := h.Get("Access-Control-Allow-Methods"); got != http.MethodPut {
+			t.Errorf("expected PUT to be allowed, got %q", got)
+		}
+	})
+
+	t.Run("should allow credentials on token issuance", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, tokensPath+"?user_id=86990727-379a-42ea-a71d-69179969e777", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://app.example.com")
+
+		// The user does not exist, the CORS headers are set regardless.
+		rr := executeRequest(req, mux)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("expected origin to be allowed, got %q", got)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("expected credentials to be allowed, got %q", got)
+		}
+	})
+
+	t.Run("should not allow credentials on other endpoints", func(t *testing.T) {
+		h := preflight(t, "/api/audit/events", "https://app.example.com", http.MethodGet)
+
+		if got := h.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("expected origin to be allowed, got %q", got)
+		}
+		if got := h.Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("expected no credentials, got %q", got)
+		}
+	})
+
+	t.Run("should apply configured route overrides", func(t *testing.T) {
+		cfg := newTestCORS(t, "https://app.example.com")
+		cfg.routes, err = cors.ParseRoutes([]string{"/api/audit POST credentials"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app := newTestApplication(t, config{})
+		app.cors, err = newCORS(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodOptions, "/api/audit/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+		rr := executeRequest(req, app.mount())
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("expected credentials on the override, got %q", got)
+		}
+
+		req.URL.Path = refreshPath
+		rr = executeRequest(req, app.mount())
+		if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("expected no credentials once the defaults are replaced, got %q", got)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		allowed bool
+	}{
+		{"should allow a wildcard subdomain", "https://pr-42.preview.example.com", http.MethodPost, true},
+		{"should not allow the wildcard apex", "https://preview.example.com", http.MethodPost, false},
+		{"should not allow another scheme", "http://app.example.com", http.MethodPost, false},
+		{"should not allow a suffix of the origin", "https://evilapp.example.com", http.MethodPost, false},
+		{"should not allow an unlisted origin", "https://evil.example.com", http.MethodPost, false},
+		{"should not allow an unlisted method", "https://app.example.com", http.MethodDelete, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := preflight(t, refreshPath, tt.origin, tt.method)
+
+			got := h.Get("Access-Control-Allow-Origin")
+			if tt.allowed && got != tt.origin {
+				t.Errorf("expected origin to be reflected, got %q", got)
+			}
+			if !tt.allowed && got != "" {
+				t.Errorf("expected origin not to be allowed, got %q", got)
+			}
+		})
+	}
+
+	t.Run("should trust credentialed origins for CSRF", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, refreshPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Sec-Fetch-Site", "same-site")
+
+		// Without an access token the request stops at 401, past the CSRF check.
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("expected origin to be allowed, got %q", got)
+		}
+		if got := rr.Header().Get("Access-Control-Expose-Headers"); got != "Retry-After" {
+			t.Errorf("expected exposed headers, got %q", got)
+		}
+	})
+
+	t.Run("should never reflect any origin with credentials", func(t *testing.T) {
+		if _, err := newCORS(newTestCORS(t, "*")); err == nil {
+			t.Error("expected credentials with any origin to be refused")
+		}
+
+		cfg := newTestCORS(t, "*")
+		cfg.credentials = false
+		app := newTestApplication(t, config{})
+		app.cors, err = newCORS(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://any.example.org")
+
+		rr := executeRequest(req, app.mount())
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("expected any origin to be allowed, got %q", got)
+		}
+	})
+}
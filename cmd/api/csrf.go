@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/lostxs/BackDev-test/internal/metrics"
+)
+
+// CSRFMiddleware rejects cross-origin browser requests to endpoints that are
+// authenticated by a cookie. Browsers send Sec-Fetch-Site or Origin with every
+// POST, clients that send neither, such as curl, carry no ambient cookies and
+// are let through.
+func (a *app) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.checkOrigin(r); err != nil {
+			setFailureReason(r, metrics.ReasonCSRF)
+			a.forbiddenException(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *app) checkOrigin(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin != "" && slices.Contains(a.config.auth.csrf.trustedOrigins, origin) {
+		return nil
+	}
+	// Origins allowed to send credentials over CORS are trusted as well.
+	if a.cors != nil && a.cors.AllowsCredentials(r) {
+		return nil
+	}
+
+	switch site := r.Header.Get("Sec-Fetch-Site"); site {
+	case "same-origin", "none":
+		return nil
+	case "":
+		// Browsers without Fetch Metadata still send Origin.
+	default:
+		return fmt.Errorf("%s request from origin %q", site, origin)
+	}
+
+	if origin == "" {
+		return nil
+	}
+	if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+		return fmt.Errorf("origin %q does not match host %q", origin, r.Host)
+	}
+	return nil
+}
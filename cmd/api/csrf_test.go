@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{
+			csrf: csrfConfig{trustedOrigins: []string{"https://app.example.com"}},
+		},
+	})
+
+	mux := app.mount()
+
+	// Requests that pass the check carry no access token and stop at 401.
+	tests := []struct {
+		name    string
+		headers map[string]string
+		code    int
+	}{
+		{"should reject cross-site fetch metadata", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.com"}, http.StatusForbidden},
+		{"should reject same-site fetch metadata", map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://other.api.example.com"}, http.StatusForbidden},
+		{"should reject a foreign origin", map[string]string{"Origin": "https://evil.example.com"}, http.StatusForbidden},
+		{"should reject a null origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"should allow same-origin fetch metadata", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusUnauthorized},
+		{"should allow a matching origin", map[string]string{"Origin": "http://api.example.com"}, http.StatusUnauthorized},
+		{"should allow a trusted origin", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://app.example.com"}, http.StatusUnauthorized},
+		{"should allow clients without browser headers", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://api.example.com/api/auth/refresh", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, tt.code, rr.Code)
+		})
+	}
+
+	t.Run("should not refresh over GET", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -1,24 +1,70 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/logging"
 )
 
 func (a *app) badRequestException(w http.ResponseWriter, r *http.Request, err error) {
-	log.Printf("%s %s: %s", r.Method, r.URL.Path, err.Error())
+	logging.FromContext(r.Context()).Warn("bad request", "error", err)
 
 	writeJSONError(w, http.StatusBadRequest, err.Error())
 }
 
 func (a *app) unauthorizedException(w http.ResponseWriter, r *http.Request, err error) {
-	log.Printf("%s %s: %s", r.Method, r.URL.Path, err.Error())
+	logging.FromContext(r.Context()).Warn("unauthorized", "error", err)
 
 	writeJSONError(w, http.StatusUnauthorized, err.Error())
 }
 
+func (a *app) forbiddenException(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Warn("forbidden", "error", err)
+
+	writeJSONError(w, http.StatusForbidden, err.Error())
+}
+
+func (a *app) insufficientScopeException(w http.ResponseWriter, r *http.Request, scope string) {
+	logging.FromContext(r.Context()).Warn("insufficient scope", "required_scope", scope)
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+	writeJSONError(w, http.StatusForbidden, "insufficient_scope")
+}
+
+// stepUpRequiredException asks the client to authenticate again, recently
+// enough or with a stronger method, see RFC 9470.
+func (a *app) stepUpRequiredException(w http.ResponseWriter, r *http.Request, reason string, challenge stepUpChallenge) {
+	logging.FromContext(r.Context()).Warn("step-up required", "reason", reason)
+
+	w.Header().Set("WWW-Authenticate", challenge.String())
+	writeJSONError(w, http.StatusUnauthorized, "insufficient_user_authentication")
+}
+
+func (a *app) notFoundException(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Info("not found", "error", err)
+
+	writeJSONError(w, http.StatusNotFound, err.Error())
+}
+
+func (a *app) conflictException(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Info("conflict", "error", err)
+
+	writeJSONError(w, http.StatusConflict, err.Error())
+}
+
+// tooManyRequestsException expects the RateLimit headers to be set already.
+func (a *app) tooManyRequestsException(w http.ResponseWriter, r *http.Request, err error, retryAfter time.Duration) {
+	logging.FromContext(r.Context()).Warn("too many requests", "error", err)
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	writeJSONError(w, http.StatusTooManyRequests, err.Error())
+}
+
 func (a *app) internalServerException(w http.ResponseWriter, r *http.Request, err error) {
-	log.Printf("%s %s: %s", r.Method, r.URL.Path, err.Error())
+	logging.FromContext(r.Context()).Error("internal server error", "error", err)
 
 	writeJSONError(w, http.StatusInternalServerError, err.Error())
 }
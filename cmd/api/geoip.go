@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/lostxs/BackDev-test/internal/geoip"
+	"github.com/lostxs/BackDev-test/internal/logging"
+)
+
+// locate is best-effort, a missing database or a failed lookup only means the
+// location is unknown.
+func (a *app) locate(r *http.Request, ip string) *geoip.Location {
+	if a.geo == nil {
+		return nil
+	}
+
+	location, err := a.geo.Lookup(ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("geoip lookup failed", "ip", ip, "error", err)
+		return nil
+	}
+
+	return location
+}
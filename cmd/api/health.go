@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostxs/BackDev-test/internal/logging"
+)
+
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+var errShuttingDown = errors.New("shutting down")
+
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// healthzHandler is the liveness probe, it only tells that the process
+// serves requests.
+func (a *app) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.jsonResponse(w, http.StatusOK, HealthResponse{Status: healthStatusOK}); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+// readyzHandler is the readiness probe, it runs every dependency check
+// concurrently and fails if any of them does or the server is shutting down.
+func (a *app) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if timeout := a.config.readiness.timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	checks := a.readinessChecks()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	response := HealthResponse{Status: healthStatusOK, Checks: make(map[string]HealthCheck, len(checks))}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			result := HealthCheck{
+				Status:    healthStatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = healthStatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[name] = result
+			if err != nil {
+				response.Status = healthStatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if response.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+		logging.FromContext(r.Context()).Warn("not ready", "checks", response.Checks)
+	}
+
+	if err := a.jsonResponse(w, status, response); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) readinessChecks() map[string]func(context.Context) error {
+	checks := map[string]func(context.Context) error{
+		"shutdown":    a.checkShutdown,
+		"signing_key": a.checkSigningKey,
+		"outbox":      a.checkOutbox,
+	}
+	if a.db != nil {
+		checks["database"] = a.db.PingContext
+	}
+	return checks
+}
+
+func (a *app) checkShutdown(ctx context.Context) error {
+	if a.shuttingDown.Load() {
+		return errShuttingDown
+	}
+	return nil
+}
+
+// checkSigningKey signs and validates a throwaway token.
+func (a *app) checkSigningKey(ctx context.Context) error {
+	token, err := a.authenticator.GenerateAccessToken(jwt.MapClaims{
+		"sub": "readyz",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.authenticator.ValidateAccessToken(token)
+	return err
+}
+
+// checkOutbox fails when notifications pile up, usually because the mail
+// server or webhook receivers are unreachable.
+func (a *app) checkOutbox(ctx context.Context) error {
+	backlog, err := a.store.Outbox.Backlog(ctx)
+	if err != nil {
+		return err
+	}
+
+	limits := a.config.readiness
+	if limits.maxOutboxPending > 0 && backlog.Pending > limits.maxOutboxPending {
+		return fmt.Errorf("%d pending messages, at most %d allowed", backlog.Pending, limits.maxOutboxPending)
+	}
+	if limits.maxOutboxAge > 0 && backlog.Oldest != nil && time.Since(*backlog.Oldest) > limits.maxOutboxAge {
+		return fmt.Errorf("oldest pending message is %s old", time.Since(*backlog.Oldest).Round(time.Second))
+	}
+
+	return nil
+}
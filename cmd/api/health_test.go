@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+type pingFunc func(context.Context) error
+
+func (f pingFunc) PingContext(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestHealthHandlers(t *testing.T) {
+	app := newTestApplication(t, config{
+		readiness: readinessConfig{maxOutboxPending: 1},
+	})
+
+	var dbErr error
+	app.db = pingFunc(func(context.Context) error { return dbErr })
+
+	mux := app.mount()
+
+	probe := func(path string) (int, HealthResponse) {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		var body struct {
+			Data HealthResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Code, body.Data
+	}
+
+	t.Run("should report liveness", func(t *testing.T) {
+		code, res := probe("/healthz")
+		checkResponseCode(t, http.StatusOK, code)
+
+		if res.Status != healthStatusOK {
+			t.Errorf("expected status ok, got %q", res.Status)
+		}
+	})
+
+	t.Run("should be ready when every check passes", func(t *testing.T) {
+		code, res := probe("/readyz")
+		checkResponseCode(t, http.StatusOK, code)
+
+		for _, name := range []string{"database", "signing_key", "outbox", "shutdown"} {
+			if res.Checks[name].Status != healthStatusOK {
+				t.Errorf("expected %s check to pass, got %+v", name, res.Checks[name])
+			}
+		}
+	})
+
+	t.Run("should not be ready without database", func(t *testing.T) {
+		dbErr = errors.New("connection refused")
+		defer func() { dbErr = nil }()
+
+		code, res := probe("/readyz")
+		checkResponseCode(t, http.StatusServiceUnavailable, code)
+
+		if check := res.Checks["database"]; check.Status != healthStatusFail || check.Error != "connection refused" {
+			t.Errorf("expected failed database check, got %+v", check)
+		}
+	})
+
+	t.Run("should not be ready with an outbox backlog", func(t *testing.T) {
+		outbox := app.store.Outbox.(*store.MockOutboxStore)
+		outbox.Create(context.Background(),
+			&store.OutboxMessage{IdempotencyKey: "a", Kind: store.OutboxKindEmail},
+			&store.OutboxMessage{IdempotencyKey: "b", Kind: store.OutboxKindEmail},
+		)
+		defer func() { outbox.Messages = nil }()
+
+		code, res := probe("/readyz")
+		checkResponseCode(t, http.StatusServiceUnavailable, code)
+
+		if res.Checks["outbox"].Status != healthStatusFail {
+			t.Errorf("expected failed outbox check, got %+v", res.Checks["outbox"])
+		}
+	})
+
+	t.Run("should not be ready while shutting down", func(t *testing.T) {
+		app.shuttingDown.Store(true)
+		defer app.shuttingDown.Store(false)
+
+		code, _ := probe("/readyz")
+		checkResponseCode(t, http.StatusServiceUnavailable, code)
+
+		code, _ = probe("/healthz")
+		checkResponseCode(t, http.StatusOK, code)
+	})
+}
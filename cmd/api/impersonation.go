@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/metrics"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+type ImpersonateResponse struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// impersonateUserHandler issues a short-lived access token for the target
+// user on behalf of the admin. No refresh token or session is created.
+func (a *app) impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromContext(r)
+	user := getTargetUserFromContext(r)
+
+	if user.ID == admin.ID {
+		a.badRequestException(w, r, errSelfAction)
+		return
+	}
+
+	if user.IsDisabled() {
+		a.badRequestException(w, r, fmt.Errorf("cannot impersonate disabled user"))
+		return
+	}
+
+	roles, err := a.store.Roles.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	exp := a.config.auth.impersonation.exp
+
+	if err := a.recordAuditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionUserImpersonated,
+		ActorID:   admin.ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"expires_in": exp.String()},
+	}); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	accessToken, err := a.createAccessToken(accessTokenParams{
+		userID:    user.ID,
+		ipAddress: getClientIP(r),
+		roles:     roles,
+		scope:     store.Permissions(roles),
+		actorID:   admin.ID,
+		// The token is as strong as the admin's own authentication.
+		authentication: getAuthenticationFromContext(r),
+	}, exp)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	metrics.TokensIssued.WithLabelValues("impersonation").Inc()
+
+	if err := a.jsonResponse(w, http.StatusOK, ImpersonateResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   time.Now().Add(exp),
+	}); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
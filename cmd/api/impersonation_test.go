@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func TestImpersonateUserHandler(t *testing.T) {
+	cfg := config{
+		auth: authConfig{
+			impersonation: impersonationConfig{exp: 5 * time.Minute},
+		},
+	}
+
+	app := newTestApplication(t, cfg)
+
+	adminID := "86990727-379a-42ea-a71d-69179969e777"
+	userID := "1e2e06f9-a42f-4e9e-a5e0-f2f376e70dc6"
+
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: adminID, Email: "admin@test.com"})
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: userID, Email: "user@test.com"})
+
+	mux := app.mount()
+
+	t.Run("should return 403 without permission", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/users/"+userID+"/impersonate", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "users:read"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should issue audited token without refresh cookie", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/users/"+userID+"/impersonate", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, adminID, "users:impersonate"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if len(rr.Result().Cookies()) != 0 {
+			t.Errorf("expected no cookies, got %v", rr.Result().Cookies())
+		}
+
+		events := app.store.Audit.(*store.MockAuditStore).Events
+		if len(events) != 1 || events[0].Action != store.AuditActionUserImpersonated || events[0].ActorID != adminID || events[0].SubjectID != userID {
+			t.Fatalf("expected impersonation audit event, got %+v", events)
+		}
+
+		var body struct {
+			Data ImpersonateResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err = http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+body.Data.AccessToken)
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
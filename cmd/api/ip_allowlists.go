@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lostxs/BackDev-test/internal/clientip"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+type AddAllowlistEntryPayload struct {
+	CIDR        string `json:"cidr"`
+	Description string `json:"description"`
+}
+
+// ipAllowed checks ip against the user's and the organization's allowlists.
+// Each list that is not empty must contain the address, so a user list can
+// only narrow what the organization allows. The returned scope names the
+// list that rejected the address.
+func (a *app) ipAllowed(ctx context.Context, user *store.User, ip string) (bool, string, error) {
+	owners := map[string]string{"user": user.ID}
+	if user.OrganizationID != "" {
+		owners["organization"] = user.OrganizationID
+	}
+
+	addr, ok := clientip.ParseAddr(ip)
+
+	for _, scope := range []string{"organization", "user"} {
+		ownerID, exists := owners[scope]
+		if !exists {
+			continue
+		}
+
+		entries, err := a.store.IPAllowlists.List(ctx, ownerID)
+		if err != nil {
+			return false, "", err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		if !ok || !allowlistContains(entries, addr) {
+			return false, scope, nil
+		}
+	}
+
+	return true, "", nil
+}
+
+func allowlistContains(entries []*store.IPAllowlistEntry, addr netip.Addr) bool {
+	for _, entry := range entries {
+		prefix, err := netip.ParsePrefix(entry.CIDR)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceIPAllowlist writes the error response and returns false when the
+// client address is not allowed for the user.
+func (a *app) enforceIPAllowlist(w http.ResponseWriter, r *http.Request, user *store.User) bool {
+	ip := getClientIP(r)
+
+	allowed, scope, err := a.ipAllowed(r.Context(), user, ip)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return false
+	}
+	if allowed {
+		return true
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionIPNotAllowed,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"allowlist": scope},
+	})
+	a.forbiddenException(w, r, fmt.Errorf("ip address %s is not in the %s allowlist", ip, scope))
+	return false
+}
+
+// allowlistOwner returns an entry template owned by the user or organization
+// loaded by the admin context middlewares.
+func allowlistOwner(r *http.Request) (*store.IPAllowlistEntry, string) {
+	if org := getOrganizationFromContext(r); org != nil {
+		return &store.IPAllowlistEntry{OrganizationID: org.ID}, org.ID
+	}
+
+	user := getTargetUserFromContext(r)
+	return &store.IPAllowlistEntry{UserID: user.ID}, user.ID
+}
+
+func (a *app) listAllowlistHandler(w http.ResponseWriter, r *http.Request) {
+	_, ownerID := allowlistOwner(r)
+
+	entries, err := a.store.IPAllowlists.List(r.Context(), ownerID)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	if err := a.jsonResponse(w, http.StatusOK, entries); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) addAllowlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var payload AddAllowlistEntryPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		a.badRequestException(w, r, err)
+		return
+	}
+
+	prefixes, err := clientip.ParsePrefixes(payload.CIDR)
+	if err != nil || len(prefixes) != 1 {
+		a.badRequestException(w, r, fmt.Errorf("cidr must be a single network or address"))
+		return
+	}
+
+	entry, ownerID := allowlistOwner(r)
+	entry.CIDR = prefixes[0].String()
+	entry.Description = payload.Description
+
+	if err := a.store.IPAllowlists.Create(r.Context(), entry); err != nil {
+		a.internalServerException(w, r, err)
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionAllowlistAdded,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: entry.UserID,
+		Metadata:  map[string]any{"owner_id": ownerID, "entry_id": entry.ID, "cidr": entry.CIDR},
+	})
+
+	if err := a.jsonResponse(w, http.StatusCreated, entry); err != nil {
+		a.internalServerException(w, r, err)
+	}
+}
+
+func (a *app) deleteAllowlistEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "entryID"), 10, 64)
+	if err != nil {
+		a.notFoundException(w, r, store.ErrAllowlistEntryNotFound)
+		return
+	}
+
+	entry, ownerID := allowlistOwner(r)
+
+	if err := a.store.IPAllowlists.Delete(r.Context(), ownerID, id); err != nil {
+		switch err {
+		case store.ErrAllowlistEntryNotFound:
+			a.notFoundException(w, r, err)
+		default:
+			a.internalServerException(w, r, err)
+		}
+		return
+	}
+
+	a.auditEvent(r, &store.AuditEvent{
+		Action:    store.AuditActionAllowlistRemoved,
+		ActorID:   getUserFromContext(r).ID,
+		SubjectID: entry.UserID,
+		Metadata:  map[string]any{"owner_id": ownerID, "entry_id": id},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
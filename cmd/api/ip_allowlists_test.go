@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func TestIPAllowlists(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	adminID := "86990727-379a-42ea-a71d-69179969e777"
+	userID := "1e2e06f9-a42f-4e9e-a5e0-f2f376e70dc6"
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: adminID, Email: "admin@test.com"})
+	mockUserStore.Create(context.Background(), nil, &store.User{ID: userID, Email: "user@test.com"})
+
+	adminToken := newTestAccessToken(t, app, adminID, "users:read", "users:write", "organizations:manage")
+
+	mux := app.mount()
+
+	adminRequest := func(method, path, body string) int {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	createTokens := func(remoteAddr string) int {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = remoteAddr
+
+		return executeRequest(req, mux).Code
+	}
+
+	var orgID string
+
+	t.Run("should create organization and assign user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/api/admin/organizations", strings.NewReader(`{"name":"Acme"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var created struct {
+			Data store.Organization `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		orgID = created.Data.ID
+
+		checkResponseCode(t, http.StatusOK, adminRequest(http.MethodPut, "/api/admin/users/"+userID+"/organization", `{"organization_id":"`+orgID+`"}`))
+	})
+
+	t.Run("should reject invalid cidr", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, adminRequest(http.MethodPost, "/api/admin/organizations/"+orgID+"/ip-allowlist", `{"cidr":"10.0.0.0/33"}`))
+	})
+
+	t.Run("should enforce organization allowlist", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, adminRequest(http.MethodPost, "/api/admin/organizations/"+orgID+"/ip-allowlist", `{"cidr":"10.0.0.0/8","description":"office"}`))
+
+		checkResponseCode(t, http.StatusOK, createTokens("10.1.2.3:8080"))
+		checkResponseCode(t, http.StatusForbidden, createTokens("192.0.2.1:8080"))
+
+		events := app.store.Audit.(*store.MockAuditStore).Events
+		last := events[len(events)-1]
+		if last.Action != store.AuditActionIPNotAllowed || last.SubjectID != userID || last.Metadata["allowlist"] != "organization" {
+			t.Errorf("expected ip.not_allowed event for the organization allowlist, got %+v", last)
+		}
+	})
+
+	t.Run("should narrow organization allowlist with user allowlist", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, adminRequest(http.MethodPost, "/api/admin/users/"+userID+"/ip-allowlist", `{"cidr":"10.1.0.0/16"}`))
+
+		checkResponseCode(t, http.StatusOK, createTokens("10.1.2.3:8080"))
+		checkResponseCode(t, http.StatusForbidden, createTokens("10.2.0.1:8080"))
+	})
+
+	t.Run("should enforce allowlist on access tokens", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/api/audit/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = "192.0.2.1:8080"
+		req.Header.Set("Authorization", "Bearer "+newTestAccessToken(t, app, userID))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should lift organization allowlist when organization is deleted", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, adminRequest(http.MethodDelete, "/api/admin/organizations/"+orgID, ""))
+		checkResponseCode(t, http.StatusNoContent, adminRequest(http.MethodDelete, "/api/admin/users/"+userID+"/ip-allowlist/2", ""))
+
+		checkResponseCode(t, http.StatusOK, createTokens("192.0.2.1:8080"))
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lostxs/BackDev-test/internal/mailer"
+)
+
+// serveSMTP answers a single SMTP session on l and sends the MAIL FROM
+// argument to from.
+func serveSMTP(l net.Listener, from chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+
+		switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+		case "MAIL":
+			from <- strings.TrimPrefix(line, "MAIL FROM:")
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+			}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	from := make(chan string, 1)
+	go serveSMTP(l, from)
+
+	m, err := newMailer(mailerConfig{
+		kind: "smtp",
+		smtp: mailer.SMTPConfig{
+			Host: "127.0.0.1",
+			Port: l.Addr().(*net.TCPAddr).Port,
+			From: "Auth <no-reply@example.com>",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should send the bare address as the envelope sender", func(t *testing.T) {
+		err := m.Send(context.Background(), &mailer.Message{
+			To:      []string{"test@test.com"},
+			Subject: "Test",
+			Text:    "Test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := <-from; got != "<no-reply@example.com>" {
+			t.Errorf("expected MAIL FROM:<no-reply@example.com>, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lostxs/BackDev-test/internal/metrics"
+)
+
+const failureReasonCtx contextKey = "failure_reason"
+
+// MetricsMiddleware observes handler latency by route pattern rather than
+// path, so IDs in the URL do not create new series.
+func (a *app) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HandlerDuration.
+			WithLabelValues(r.Method, route, strconv.Itoa(responseStatus(ww))).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// failureReason is filled in by whichever middleware or handler rejects a
+// request, for an outer middleware to count.
+type failureReason struct {
+	reason string
+}
+
+func setFailureReason(r *http.Request, reason string) {
+	if f, ok := r.Context().Value(failureReasonCtx).(*failureReason); ok && f.reason == "" {
+		f.reason = reason
+	}
+}
+
+// RefreshMetricsMiddleware counts refreshes and failed refreshes by reason,
+// it must be mounted before AccessTokenMiddleware to see expired tokens.
+func (a *app) RefreshMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failure := &failureReason{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), failureReasonCtx, failure)))
+
+		if responseStatus(ww) < http.StatusBadRequest {
+			metrics.Refreshes.Inc()
+			return
+		}
+		if failure.reason == "" {
+			failure.reason = metrics.ReasonOther
+		}
+		metrics.RefreshFailures.WithLabelValues(failure.reason).Inc()
+	})
+}
+
+// responseStatus is the status written by the handler, handlers that only
+// write a body implicitly answer 200.
+func responseStatus(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
+
+// runMetrics serves /metrics on its own listener so it is never exposed
+// together with the public API, until ctx is cancelled.
+func (a *app) runMetrics(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	srv := &http.Server{
+		Addr:         a.config.metricsAddr,
+		Handler:      mux,
+		WriteTimeout: time.Second * 30,
+		ReadTimeout:  time.Second * 10,
+		IdleTimeout:  time.Minute,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		a.logger.Info("starting metrics server", "addr", a.config.metricsAddr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return shutdownServer(srv, a.config.shutdown.timeout)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostxs/BackDev-test/internal/metrics"
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	userID := "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	mux := app.mount()
+
+	refresh := func(token, refreshToken string) {
+		req, err := http.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = "127.0.0.1:8080"
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: refreshToken})
+
+		executeRequest(req, mux)
+	}
+
+	t.Run("should count issued tokens", func(t *testing.T) {
+		issued := testutil.ToFloat64(metrics.TokensIssued.WithLabelValues("create"))
+
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = "127.0.0.1:8080"
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if got := testutil.ToFloat64(metrics.TokensIssued.WithLabelValues("create")); got != issued+1 {
+			t.Errorf("expected %v issued tokens, got %v", issued+1, got)
+		}
+	})
+
+	t.Run("should count refresh failures by reason", func(t *testing.T) {
+		expiredToken, err := app.authenticator.GenerateAccessToken(jwt.MapClaims{
+			"sub":        userID,
+			"ip_address": "127.0.0.1",
+			"exp":        time.Now().Add(-time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			reason string
+			token  string
+		}{
+			{metrics.ReasonExpired, expiredToken},
+			{metrics.ReasonMismatch, newTestAccessToken(t, app, userID)},
+		} {
+			before := testutil.ToFloat64(metrics.RefreshFailures.WithLabelValues(tt.reason))
+			refresh(tt.token, "stolen-refresh-token")
+
+			if got := testutil.ToFloat64(metrics.RefreshFailures.WithLabelValues(tt.reason)); got != before+1 {
+				t.Errorf("expected %v %s failures, got %v", before+1, tt.reason, got)
+			}
+		}
+	})
+
+	t.Run("should expose latency by route pattern", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		for _, expected := range []string{
+			`backdev_http_request_duration_seconds_count{method="GET",route="/api/auth/tokens",status="200"}`,
+			`backdev_bcrypt_duration_seconds_count`,
+		} {
+			if !strings.Contains(rr.Body.String(), expected) {
+				t.Errorf("expected %s in metrics output", expected)
+			}
+		}
+	})
+}
@@ -2,21 +2,75 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostxs/BackDev-test/internal/clientip"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/metrics"
 	"github.com/lostxs/BackDev-test/internal/store"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
 
 const (
-	userCtx      contextKey = "user"
-	ipAddressCtx contextKey = "ip_address"
+	userCtx        contextKey = "user"
+	ipAddressCtx   contextKey = "ip_address"
+	rolesCtx       contextKey = "roles"
+	permissionsCtx contextKey = "permissions"
+	scopeCtx       contextKey = "scope"
+	actorCtx       contextKey = "actor"
+	clientIPCtx    contextKey = "client_ip"
+	clientCtx      contextKey = "client"
 )
 
+// RequestLoggerMiddleware scopes the logger to the request and logs its
+// completion. It must be mounted after RequestID, ClientIPMiddleware and
+// TracingMiddleware, later middlewares and handlers add to it with
+// logging.With.
+func (a *app) RequestLoggerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		logger := a.logger.With(
+			"request_id", middleware.GetReqID(r.Context()),
+			"client_ip", getClientIP(r),
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String(), "span_id", span.SpanID().String())
+		}
+		logger.Debug("request started", "user_agent", r.UserAgent(), "headers", logging.Headers(r.Header))
+
+		ctx := logging.WithContext(r.Context(), logger)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		logging.FromContext(ctx).Info("request completed",
+			"status", responseStatus(ww),
+			"bytes", ww.BytesWritten(),
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// ClientIPMiddleware resolves the client address once per request, honouring
+// forwarding headers only from trusted proxies.
+func (a *app) ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPCtx, a.config.clientIP.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (a *app) AccessTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -34,6 +88,11 @@ func (a *app) AccessTokenMiddleware(next http.Handler) http.Handler {
 		token := parts[1]
 		jwtToken, err := a.authenticator.ValidateAccessToken(token)
 		if err != nil {
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				setFailureReason(r, metrics.ReasonExpired)
+			} else {
+				setFailureReason(r, metrics.ReasonInvalidToken)
+			}
 			a.unauthorizedException(w, r, err)
 			return
 		}
@@ -60,16 +119,147 @@ func (a *app) AccessTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// The allowlist applies to whoever holds the token, which is the
+		// admin rather than the user while impersonating.
+		holder := user
+		if act, ok := claims["act"].(map[string]any); ok {
+			actorID, _ := act["sub"].(string)
+			actor, err := a.getUser(ctx, actorID)
+			if err != nil {
+				a.unauthorizedException(w, r, fmt.Errorf("impersonating user: %w", err))
+				return
+			}
+			ctx = context.WithValue(ctx, actorCtx, actor)
+			holder = actor
+			logging.With(ctx, "actor_id", actor.ID)
+		}
+		logging.With(ctx, "user_id", user.ID)
+
+		if !a.enforceIPAllowlist(w, r, holder) {
+			return
+		}
+
 		ctx = context.WithValue(ctx, userCtx, user)
 		ctx = context.WithValue(ctx, ipAddressCtx, tokenIPAddress)
+		ctx = context.WithValue(ctx, rolesCtx, claimStrings(claims, "roles"))
+		ctx = context.WithValue(ctx, permissionsCtx, claimStrings(claims, "permissions"))
+		ctx = context.WithValue(ctx, scopeCtx, claimScope(claims))
+		if clientID, ok := claims["client_id"].(string); ok {
+			ctx = context.WithValue(ctx, clientCtx, clientID)
+		}
+		ctx = withAuthentication(ctx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// RequirePermission must be mounted after AccessTokenMiddleware. The user
+// must hold the permission through a role, and the access token must have
+// been granted it as a scope, so a narrowly scoped token reaches no further.
+func (a *app) RequirePermission(permission string) func(http.Handler) http.Handler {
+	requireScope := a.RequireScope(permission)
+
+	return func(next http.Handler) http.Handler {
+		scoped := requireScope(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			permissions, _ := r.Context().Value(permissionsCtx).([]string)
+			if !slices.Contains(permissions, permission) {
+				a.forbiddenException(w, r, fmt.Errorf("missing permission %q", permission))
+				return
+			}
+
+			scoped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope must be mounted after AccessTokenMiddleware, it checks the
+// scope granted to the access token rather than everything the user may do.
+func (a *app) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted, _ := r.Context().Value(scopeCtx).([]string)
+			if !slices.Contains(granted, scope) {
+				a.insufficientScopeException(w, r, scope)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectImpersonation must be mounted after AccessTokenMiddleware, it guards
+// sensitive endpoints from tokens issued through admin impersonation.
+func (a *app) RejectImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getActorFromContext(r) != nil {
+			a.forbiddenException(w, r, fmt.Errorf("not allowed while impersonating"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getActorFromContext(r *http.Request) *store.User {
+	actor, _ := r.Context().Value(actorCtx).(*store.User)
+	return actor
+}
+
+// getClientIP returns the address resolved by ClientIPMiddleware. Requests
+// that did not pass through it fall back to the peer address.
+func getClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPCtx).(string); ok {
+		return ip
+	}
+	return clientip.Resolver{}.ClientIP(r)
+}
+
+// getClientFromContext returns the OAuth client the access token was issued
+// to, empty when none identified itself.
+func getClientFromContext(r *http.Request) string {
+	clientID, _ := r.Context().Value(clientCtx).(string)
+	return clientID
+}
+
+func getUserFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(userCtx).(*store.User)
+	return user
+}
+
+func claimScope(claims jwt.MapClaims) []string {
+	scope, _ := claims["scope"].(string)
+	return strings.Fields(scope)
+}
+
+func claimStrings(claims jwt.MapClaims, key string) []string {
+	raw, ok := claims[key].([]any)
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
+
+var errUserDisabled = errors.New("user is disabled")
+
+// getUser loads the user a token is issued to or presented by, disabled users
+// are rejected so their outstanding access tokens stop working immediately.
 func (a *app) getUser(ctx context.Context, userID string) (*store.User, error) {
 	user, err := a.store.Users.GetByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	if user.IsDisabled() {
+		return nil, errUserDisabled
+	}
 	return user, nil
 }
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostxs/BackDev-test/internal/auth"
+	"github.com/lostxs/BackDev-test/internal/clientip"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func TestRequirePermission(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{
+		ID:    "86990727-379a-42ea-a71d-69179969e777",
+		Email: "test@test.com",
+	})
+
+	mux := chi.NewRouter()
+	mux.With(app.AccessTokenMiddleware, app.RequirePermission("sessions:revoke")).
+		Get("/protected", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+	newToken := func(permissions []string) string {
+		token, err := app.authenticator.GenerateAccessToken(jwt.MapClaims{
+			"sub":         "86990727-379a-42ea-a71d-69179969e777",
+			"ip_address":  "127.0.0.1",
+			"roles":       []string{"admin"},
+			"permissions": permissions,
+			"scope":       strings.Join(permissions, " "),
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	t.Run("should return 403 if permission is missing", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/protected", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newToken([]string{"users:read"}))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should return 403 insufficient_scope if scope is missing", func(t *testing.T) {
+		token, err := app.authenticator.GenerateAccessToken(jwt.MapClaims{
+			"sub":         "86990727-379a-42ea-a71d-69179969e777",
+			"ip_address":  "127.0.0.1",
+			"permissions": []string{"sessions:revoke"},
+			"scope":       "users:read",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/protected", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+
+		expected := `Bearer error="insufficient_scope", scope="sessions:revoke"`
+		if got := rr.Header().Get("WWW-Authenticate"); got != expected {
+			t.Errorf("expected WWW-Authenticate %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("should allow request with permission", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/protected", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newToken([]string{"sessions:revoke"}))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+}
+
+func TestRequireScope(t *testing.T) {
+	cfg := config{}
+
+	app := newTestApplication(t, cfg)
+
+	mockUserStore := app.store.Users.(*store.MockUserStore)
+	mockUserStore.Create(context.Background(), nil, &store.User{
+		ID:    "86990727-379a-42ea-a71d-69179969e777",
+		Email: "test@test.com",
+	})
+
+	mux := chi.NewRouter()
+	mux.With(app.AccessTokenMiddleware, app.RequireScope("users:write")).
+		Get("/protected", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+	newToken := func(scope string) string {
+		token, err := app.authenticator.GenerateAccessToken(jwt.MapClaims{
+			"sub":         "86990727-379a-42ea-a71d-69179969e777",
+			"ip_address":  "127.0.0.1",
+			"permissions": []string{"users:read", "users:write"},
+			"scope":       scope,
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	t.Run("should return 403 insufficient_scope", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/protected", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newToken("users:read"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+
+		expected := `Bearer error="insufficient_scope", scope="users:write"`
+		if got := rr.Header().Get("WWW-Authenticate"); got != expected {
+			t.Errorf("expected WWW-Authenticate %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("should allow request with scope", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/protected", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newToken("users:read users:write"))
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	trusted, err := clientip.ParsePrefixes("10.0.0.0/8, 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t, config{clientIP: clientip.Resolver{TrustedProxies: trusted}})
+
+	mux := chi.NewRouter()
+	mux.Use(app.ClientIPMiddleware)
+	mux.Get("/ip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(getClientIP(r)))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		expected   string
+	}{
+		{"should strip port", "203.0.113.7:5555", "", "", "203.0.113.7"},
+		{"should unmap ipv4-mapped address", "[::ffff:203.0.113.7]:5555", "", "", "203.0.113.7"},
+		{"should ignore headers from untrusted peer", "203.0.113.7:5555", "X-Forwarded-For", "198.51.100.1", "203.0.113.7"},
+		{"should use x-forwarded-for from trusted proxy", "10.0.0.2:5555", "X-Forwarded-For", "198.51.100.1", "198.51.100.1"},
+		{"should not trust spoofed leftmost entry", "10.0.0.2:5555", "X-Forwarded-For", "1.2.3.4, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"should parse forwarded header", "[2001:db8::1]:443", "Forwarded", `for="[2001:db8:cafe::17]:4711";proto=https, for=10.1.1.1`, "2001:db8:cafe::17"},
+		{"should stop at obfuscated forwarded entry", "10.0.0.2:5555", "Forwarded", "for=198.51.100.1, for=_hidden", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/ip", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+
+			rr := executeRequest(req, mux)
+			if got := rr.Body.String(); got != tt.expected {
+				t.Errorf("expected client ip %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequireStepUp(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	userID := "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	mux := chi.NewRouter()
+	mux.With(app.AccessTokenMiddleware, app.RequireStepUp(15*time.Minute, auth.ACRSingleFactor)).
+		Get("/protected", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+	newToken := func(au authentication) string {
+		token, err := app.createAccessToken(accessTokenParams{
+			userID:         userID,
+			ipAddress:      "127.0.0.1",
+			authentication: au,
+		}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name      string
+		au        authentication
+		code      int
+		challenge string
+	}{
+		{
+			name: "should allow a recent authentication",
+			au:   newAuthentication(),
+			code: http.StatusNoContent,
+		},
+		{
+			name:      "should challenge a token without acr",
+			au:        authentication{},
+			code:      http.StatusUnauthorized,
+			challenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", acr_values="1", max_age="900"`,
+		},
+		{
+			name: "should challenge an old authentication",
+			au: authentication{
+				time:    time.Now().Add(-time.Hour),
+				methods: []string{auth.AMRUserID},
+				acr:     auth.ACRSingleFactor,
+			},
+			code:      http.StatusUnauthorized,
+			challenge: `Bearer error="insufficient_user_authentication", error_description="More recent authentication is required", acr_values="1", max_age="900"`,
+		},
+		{
+			name: "should accept a stronger acr",
+			au: authentication{
+				time:    time.Now(),
+				methods: []string{"pwd", "otp"},
+				acr:     auth.ACRMultiFactor,
+			},
+			code: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/protected", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+newToken(tt.au))
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, tt.code, rr.Code)
+
+			if got := rr.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("expected WWW-Authenticate %q, got %q", tt.challenge, got)
+			}
+		})
+	}
+}
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	var buf bytes.Buffer
+	app.logger = logging.New(&buf, slog.LevelDebug)
+
+	userID := "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	mux := app.mount()
+	token := newTestAccessToken(t, app, userID)
+
+	req, err := http.NewRequest(http.MethodGet, "/api/audit/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.RemoteAddr = "127.0.0.1:8080"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-secret"})
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	t.Run("should redact secrets", func(t *testing.T) {
+		for _, secret := range []string{token, "refresh-secret"} {
+			if strings.Contains(buf.String(), secret) {
+				t.Errorf("expected %q to be redacted, got %s", secret, buf.String())
+			}
+		}
+		if !strings.Contains(buf.String(), `"Authorization":"[REDACTED]"`) {
+			t.Errorf("expected redacted Authorization header, got %s", buf.String())
+		}
+	})
+
+	t.Run("should log the request with its user", func(t *testing.T) {
+		var completed map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]any
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["msg"] == "request completed" {
+				completed = entry
+			}
+		}
+
+		if completed == nil {
+			t.Fatalf("expected a request completed entry, got %s", buf.String())
+		}
+		if completed["user_id"] != userID || completed["client_ip"] != "127.0.0.1" || completed["status"] != float64(http.StatusOK) {
+			t.Errorf("unexpected entry %v", completed)
+		}
+		if id, _ := completed["request_id"].(string); id == "" {
+			t.Errorf("expected a request id, got %v", completed)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func parseLimitParam(query url.Values) (int, error) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return defaultPageLimit, nil
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/metrics"
+	"github.com/lostxs/BackDev-test/internal/ratelimit"
+)
+
+// Rate limit backends.
+const (
+	rateLimitMemory   = "memory"
+	rateLimitPostgres = "postgres"
+	rateLimitNone     = "none"
+)
+
+// RateLimit throttles route by every rule whose key the request carries. It
+// must be mounted after AccessTokenMiddleware on authenticated routes, so the
+// user and client keys are known.
+func (a *app) RateLimit(route string, rules []ratelimit.Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a.limiter == nil || len(rules) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var tightest *ratelimit.Result
+			for _, rule := range rules {
+				value := a.rateLimitKey(r, rule.Key)
+				if value == "" {
+					continue
+				}
+
+				result, err := a.limiter.Allow(r.Context(), route+":"+rule.Key+":"+value, rule.Limit)
+				if err != nil {
+					// An unavailable backend must not lock everyone out.
+					logging.FromContext(r.Context()).Error("rate limit", "rule", rule.Key, "error", err)
+					continue
+				}
+
+				if !result.Allowed {
+					setRateLimitHeaders(w, result)
+					setFailureReason(r, metrics.ReasonRateLimited)
+					metrics.RateLimited.WithLabelValues(route, rule.Key).Inc()
+					a.tooManyRequestsException(w, r, fmt.Errorf("rate limit of %s per %s exceeded", rule.Limit, rule.Key), result.RetryAfter)
+					return
+				}
+				if tightest == nil || result.Remaining < tightest.Remaining {
+					tightest = &result
+				}
+			}
+
+			if tightest != nil {
+				setRateLimitHeaders(w, *tightest)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (a *app) rateLimitKey(r *http.Request, key string) string {
+	switch key {
+	case ratelimit.KeyIP:
+		return getClientIP(r)
+	case ratelimit.KeyUser:
+		// Never the user_id of token issuance, anyone could name a victim and
+		// use up their bucket.
+		if user := getUserFromContext(r); user != nil {
+			return user.ID
+		}
+		return ""
+	case ratelimit.KeyClient:
+		if clientID := getClientFromContext(r); clientID != "" {
+			return clientID
+		}
+		// Token issuance is not authenticated, the client names itself. Only
+		// registered clients are counted, the handler rejects the rest.
+		if clientID := r.URL.Query().Get("client_id"); a.knownClient(clientID) {
+			return clientID
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+// setRateLimitHeaders reports the rule closest to its limit, see the
+// RateLimit header fields draft of the IETF httpapi working group.
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
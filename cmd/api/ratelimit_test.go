@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/ratelimit"
+)
+
+type failingBackend struct{}
+
+func (failingBackend) Take(context.Context, string, float64, float64) (float64, bool, error) {
+	return 0, false, errors.New("backend unavailable")
+}
+
+func (failingBackend) Prune(context.Context, time.Duration) error {
+	return nil
+}
+
+func TestRateLimit(t *testing.T) {
+	rules, err := ratelimit.ParseRules("client:2/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		auth:      authConfig{clients: []string{"spa", "mobile"}},
+		rateLimit: rateLimitConfig{tokens: rules},
+	}
+	app := newTestApplication(t, cfg)
+	app.limiter = ratelimit.NewLimiter(ratelimit.NewMemoryBackend())
+
+	mux := app.mount()
+
+	const userID = "1e2e06f9-a42f-4e9e-a5e0-f2f376e70dc6"
+
+	issue := func(t *testing.T, mux http.Handler, clientID string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID+"&client_id="+clientID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	t.Run("should report the remaining requests", func(t *testing.T) {
+		for _, remaining := range []string{"1", "0"} {
+			res := issue(t, mux, "spa")
+			if res.StatusCode == http.StatusTooManyRequests {
+				t.Fatal("expected request to be allowed")
+			}
+			if got := res.Header.Get("RateLimit-Limit"); got != "2" {
+				t.Errorf("expected RateLimit-Limit 2, got %q", got)
+			}
+			if got := res.Header.Get("RateLimit-Remaining"); got != remaining {
+				t.Errorf("expected RateLimit-Remaining %s, got %q", remaining, got)
+			}
+		}
+	})
+
+	t.Run("should reject requests over the limit", func(t *testing.T) {
+		res := issue(t, mux, "spa")
+		checkResponseCode(t, http.StatusTooManyRequests, res.StatusCode)
+
+		// Two requests per minute refill a token every 30 seconds.
+		if got := res.Header.Get("Retry-After"); got != "30" {
+			t.Errorf("expected Retry-After 30, got %q", got)
+		}
+		if got := res.Header.Get("RateLimit-Remaining"); got != "0" {
+			t.Errorf("expected RateLimit-Remaining 0, got %q", got)
+		}
+	})
+
+	t.Run("should limit each client separately", func(t *testing.T) {
+		res := issue(t, mux, "mobile")
+		if res.StatusCode == http.StatusTooManyRequests {
+			t.Error("expected another client to be allowed")
+		}
+	})
+
+	t.Run("should not count unregistered clients", func(t *testing.T) {
+		res := issue(t, mux, "unknown")
+		checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+
+		if res.Header.Get("RateLimit-Limit") != "" {
+			t.Error("expected no rate limit headers")
+		}
+	})
+
+	t.Run("should not limit token issuance by the user it names", func(t *testing.T) {
+		rules, err := ratelimit.ParseRules("user:1/1m")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app := newTestApplication(t, config{
+			rateLimit: rateLimitConfig{tokens: rules},
+		})
+		app.limiter = ratelimit.NewLimiter(ratelimit.NewMemoryBackend())
+		mux := app.mount()
+
+		for range 2 {
+			res := issue(t, mux, "")
+			if res.StatusCode == http.StatusTooManyRequests {
+				t.Fatal("expected request to be allowed")
+			}
+		}
+	})
+
+	t.Run("should allow requests when the backend fails", func(t *testing.T) {
+		app.limiter = ratelimit.NewLimiter(failingBackend{})
+
+		res := issue(t, app.mount(), "spa")
+		if res.StatusCode == http.StatusTooManyRequests {
+			t.Error("expected request to be allowed")
+		}
+		if res.Header.Get("RateLimit-Limit") != "" {
+			t.Error("expected no rate limit headers")
+		}
+	})
+
+	t.Run("should not limit when disabled", func(t *testing.T) {
+		mux := newTestApplication(t, cfg).mount()
+
+		for range 3 {
+			res := issue(t, mux, "spa")
+			if res.StatusCode == http.StatusTooManyRequests {
+				t.Fatal("expected request to be allowed")
+			}
+		}
+	})
+}
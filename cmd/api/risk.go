@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/geoip"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/metrics"
+	"github.com/lostxs/BackDev-test/internal/risk"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+// deviceIDHeader lets clients identify themselves more reliably than by
+// their User-Agent.
+const deviceIDHeader = "X-Device-ID"
+
+// defaultFailureWindow applies when the risk config does not set one.
+const defaultFailureWindow = time.Hour
+
+// riskFailureActions are the audit events counted as recent failures.
+var riskFailureActions = []string{
+	store.AuditActionTokenReuseDetected,
+	store.AuditActionIPNotAllowed,
+	store.AuditActionRiskBlocked,
+}
+
+type unusualSignInEmailData struct {
+	Email     string
+	UserAgent string
+	IP        string
+	Location  *geoip.Location
+	Time      time.Time
+}
+
+// riskCollectors returns the built-in signal collectors plus the ones backed
+// by the store.
+func (a *app) riskCollectors() []risk.Collector {
+	return []risk.Collector{
+		risk.NetworkCollector(a.config.auth.ipChange.matcher),
+		risk.GeoCollector(),
+		risk.NewCollector(a.collectDeviceSignal, risk.SignalNewDevice),
+		risk.NewCollector(a.collectFailureSignal, risk.SignalRecentFailures),
+	}
+}
+
+func (a *app) collectDeviceSignal(ctx context.Context, attempt *risk.Attempt, signals risk.Signals) error {
+	known, err := a.store.Devices.Exists(ctx, attempt.UserID, attempt.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	signals.SetBool(risk.SignalNewDevice, !known)
+	return nil
+}
+
+func (a *app) collectFailureSignal(ctx context.Context, attempt *risk.Attempt, signals risk.Signals) error {
+	window := time.Duration(a.risk.Config().FailureWindow)
+	if window == 0 {
+		window = defaultFailureWindow
+	}
+
+	count, err := a.store.Audit.CountRecent(ctx, attempt.UserID, riskFailureActions, attempt.Time.Add(-window))
+	if err != nil {
+		return err
+	}
+
+	signals[risk.SignalRecentFailures] = float64(count)
+	return nil
+}
+
+func deviceFingerprint(r *http.Request) string {
+	id := r.Header.Get(deviceIDHeader)
+	if id == "" {
+		id = "ua:" + r.UserAgent()
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// assessRisk scores a token issuance or refresh against the user's previous
+// session, which may be nil. It returns the notifications to store along with
+// the session, or false when the attempt was rejected and the response has
+// been written.
+func (a *app) assessRisk(w http.ResponseWriter, r *http.Request, user *store.User, previous *store.Session, refresh bool) ([]*store.OutboxMessage, bool) {
+	if a.risk == nil {
+		return nil, true
+	}
+
+	attempt := &risk.Attempt{
+		UserID:    user.ID,
+		Refresh:   refresh,
+		IP:        getClientIP(r),
+		UserAgent: r.UserAgent(),
+		DeviceID:  deviceFingerprint(r),
+		Time:      time.Now(),
+	}
+	attempt.Location = a.locate(r, attempt.IP)
+	if previous != nil {
+		attempt.PreviousIP = previous.IPAddress
+		attempt.PreviousLocation = previous.Location
+		attempt.PreviousSeen = previous.UpdatedAt
+	}
+
+	assessment, err := a.risk.Assess(r.Context(), attempt)
+	if err != nil {
+		a.internalServerException(w, r, err)
+		return nil, false
+	}
+
+	event := &store.AuditEvent{
+		SubjectID: user.ID,
+		Metadata: map[string]any{
+			"score":    assessment.Score,
+			"decision": assessment.Decision,
+			"rules":    assessment.Rules,
+			"signals":  assessment.Signals,
+		},
+	}
+
+	switch assessment.Decision {
+	case risk.Notify:
+		event.Action = store.AuditActionRiskAssessed
+		a.auditEvent(r, event)
+
+		notification, err := a.emailNotification(user, mailer.TemplateUnusualSignIn, unusualSignInEmailData{
+			Email:     user.Email,
+			UserAgent: attempt.UserAgent,
+			IP:        attempt.IP,
+			Location:  attempt.Location,
+			Time:      attempt.Time,
+		})
+		if err != nil {
+			a.internalServerException(w, r, err)
+			return nil, false
+		}
+		return []*store.OutboxMessage{notification}, true
+	case risk.Block:
+		event.Action = store.AuditActionRiskBlocked
+		a.auditEvent(r, event)
+		setFailureReason(r, metrics.ReasonRisk)
+		a.forbiddenException(w, r, fmt.Errorf("sign-in blocked, risk score %d", assessment.Score))
+		return nil, false
+	default:
+		return nil, true
+	}
+}
+
+// rememberDevice is best-effort, a failure only means the device is seen as
+// new next time.
+func (a *app) rememberDevice(r *http.Request, userID string) {
+	device := &store.Device{
+		UserID:      userID,
+		Fingerprint: deviceFingerprint(r),
+		UserAgent:   r.UserAgent(),
+	}
+	if err := a.store.Devices.Touch(r.Context(), device); err != nil {
+		logging.FromContext(r.Context()).Error("remember device", "error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lostxs/BackDev-test/internal/risk"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func TestRiskEngine(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	userID := "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	rules, err := risk.LoadConfig("../../risk.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules.Timezone = "UTC"
+	// Keep the test independent of the time of day.
+	rules.Rules = slices.DeleteFunc(rules.Rules, func(rule risk.Rule) bool {
+		return rule.Name == "night"
+	})
+
+	app.risk, err = risk.NewEngine(rules, app.riskCollectors()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := app.mount()
+
+	createTokens := func(userAgent string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = "127.0.0.1:8080"
+		req.Header.Set("User-Agent", userAgent)
+
+		return executeRequest(req, mux).Result()
+	}
+
+	outbox := app.store.Outbox.(*store.MockOutboxStore)
+	audit := app.store.Audit.(*store.MockAuditStore)
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		invalid := &risk.Config{
+			Thresholds: risk.Thresholds{Notify: 50, StepUp: 20},
+			Rules:      []risk.Rule{{Name: "empty", Score: 10}},
+		}
+		if err := app.risk.SetConfig(invalid); err == nil {
+			t.Error("expected invalid rules to be rejected")
+		}
+	})
+
+	t.Run("should reject rules on unknown signals", func(t *testing.T) {
+		misspelled := &risk.Config{
+			Rules: []risk.Rule{{Name: "new_device", Score: 10, Conditions: []risk.Condition{{Signal: "new_devise", Min: ptr(1.0)}}}},
+		}
+		if err := app.risk.SetConfig(misspelled); err == nil || !strings.Contains(err.Error(), `unknown signal "new_devise"`) {
+			t.Errorf("expected unknown signal to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("should notify about a new device", func(t *testing.T) {
+		res := createTokens("device-a")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		if len(outbox.Messages) != 1 || !strings.HasPrefix(outbox.Messages[0].IdempotencyKey, "unusual_sign_in.") {
+			t.Fatalf("expected an unusual sign-in email, got %+v", outbox.Messages)
+		}
+
+		last := audit.Events[len(audit.Events)-2]
+		if last.Action != store.AuditActionRiskAssessed || last.Metadata["decision"] != risk.Notify {
+			t.Errorf("expected risk.assessed event with notify decision, got %+v", last)
+		}
+	})
+
+	t.Run("should allow a known device", func(t *testing.T) {
+		res := createTokens("device-a")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		if len(outbox.Messages) != 1 {
+			t.Errorf("expected no new notifications, got %d", len(outbox.Messages))
+		}
+	})
+
+	t.Run("should reject a step-up threshold", func(t *testing.T) {
+		stepUp := &risk.Config{Thresholds: risk.Thresholds{Notify: 20, StepUp: 50, Block: 90}}
+		if err := app.risk.SetConfig(stepUp); err == nil || !strings.Contains(err.Error(), "step_up is not supported") {
+			t.Errorf("expected step_up threshold to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("should block after recent failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			audit.Create(context.Background(), &store.AuditEvent{
+				Action:    store.AuditActionTokenReuseDetected,
+				SubjectID: userID,
+			})
+		}
+
+		// 20 for the new device and 30 for the failures only notify.
+		res := createTokens("device-b")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		// Another 50 reaches the block threshold of 90.
+		rules.Rules = append(rules.Rules, risk.Rule{
+			Name:       "repeated_failures",
+			Score:      50,
+			Conditions: []risk.Condition{{Signal: risk.SignalRecentFailures, Min: ptr(3.0)}},
+		})
+		if err := app.risk.SetConfig(rules); err != nil {
+			t.Fatal(err)
+		}
+
+		res = createTokens("device-c")
+		checkResponseCode(t, http.StatusForbidden, res.StatusCode)
+
+		last := audit.Events[len(audit.Events)-1]
+		if last.Action != store.AuditActionRiskBlocked {
+			t.Errorf("expected risk.blocked event, got %+v", last)
+		}
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/outbox"
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	app := newTestApplication(t, config{
+		addr:     freeAddr(t),
+		shutdown: shutdownConfig{timeout: 5 * time.Second},
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- app.run(ctx, mux) }()
+
+	url := "http://" + app.config.addr
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		res, err := http.Get(url + "/ping")
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	inflight := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.Get(url + "/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		inflight <- res
+	}()
+	<-started
+
+	cancel()
+
+	t.Run("should stop being ready", func(t *testing.T) {
+		for deadline := time.Now().Add(5 * time.Second); !app.shuttingDown.Load(); {
+			if time.Now().After(deadline) {
+				t.Fatal("expected server to be marked as shutting down")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("should drain in-flight requests", func(t *testing.T) {
+		select {
+		case err := <-done:
+			t.Fatalf("expected server to wait for in-flight request, returned %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+
+		res := <-inflight
+		if res == nil {
+			t.Fatal("expected in-flight request to complete")
+		}
+		res.Body.Close()
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		if err := <-done; err != nil {
+			t.Errorf("expected clean shutdown, got %v", err)
+		}
+	})
+}
+
+func TestOutboxFlush(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	outboxStore := app.store.Outbox.(*store.MockOutboxStore)
+	for _, key := range []string{"a", "b", "c"} {
+		notification, err := app.emailNotification(&store.User{Email: "user@test.com"}, mailer.TemplateLockout, map[string]any{
+			"Email":  "user@test.com",
+			"Reason": "test",
+			"Time":   time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		notification.IdempotencyKey = key
+		outboxStore.Create(context.Background(), notification)
+	}
+
+	worker := outbox.NewWorker(app.store.Outbox, app.mailer, outbox.Config{BatchSize: 2, MaxAttempts: 1})
+
+	n, err := worker.Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 messages to be flushed, got %d", n)
+	}
+	if sent := app.mailer.(*mailer.MemoryMailer).Messages(); len(sent) != 3 {
+		t.Errorf("expected 3 emails to be sent, got %d", len(sent))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lostxs/BackDev-test/internal/auth"
+)
+
+const authenticationCtx contextKey = "authentication"
+
+// authentication describes how and when the user last authenticated. It is
+// carried by the auth_time, amr and acr claims and survives token refresh.
+type authentication struct {
+	time    time.Time
+	methods []string
+	acr     string
+}
+
+// newAuthentication is the authentication performed by token issuance.
+func newAuthentication() authentication {
+	return authentication{
+		time:    time.Now(),
+		methods: []string{auth.AMRUserID},
+		acr:     auth.ACRSingleFactor,
+	}
+}
+
+func (au authentication) claims(claims jwt.MapClaims) {
+	if au.time.IsZero() {
+		return
+	}
+	claims["auth_time"] = au.time.Unix()
+	claims["amr"] = au.methods
+	claims["acr"] = au.acr
+}
+
+func claimAuthentication(claims jwt.MapClaims) authentication {
+	au := authentication{methods: claimStrings(claims, "amr")}
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		au.time = time.Unix(int64(authTime), 0)
+	}
+	au.acr, _ = claims["acr"].(string)
+	return au
+}
+
+func getAuthenticationFromContext(r *http.Request) authentication {
+	au, _ := r.Context().Value(authenticationCtx).(authentication)
+	return au
+}
+
+func withAuthentication(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, authenticationCtx, claimAuthentication(claims))
+}
+
+// stepUpChallenge is what the client has to satisfy, see the acr_values and
+// max_age parameters of RFC 9470.
+type stepUpChallenge struct {
+	description string
+	acr         string
+	maxAge      time.Duration
+}
+
+func (c stepUpChallenge) String() string {
+	header := `Bearer error="insufficient_user_authentication"`
+	if c.description != "" {
+		header += fmt.Sprintf(`, error_description=%q`, c.description)
+	}
+	if c.acr != "" {
+		header += fmt.Sprintf(`, acr_values=%q`, c.acr)
+	}
+	if c.maxAge > 0 {
+		header += fmt.Sprintf(`, max_age="%d"`, int(c.maxAge.Seconds()))
+	}
+	return header
+}
+
+// RequireStepUp must be mounted after AccessTokenMiddleware, it demands a new
+// authentication when the token's auth_time is older than maxAge or its acr is
+// below the required one. A zero maxAge or an empty acr skips that check.
+func (a *app) RequireStepUp(maxAge time.Duration, acr string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			au := getAuthenticationFromContext(r)
+
+			if !auth.ACRSatisfies(au.acr, acr) {
+				a.stepUpRequiredException(w, r, fmt.Sprintf("acr %q below %q", au.acr, acr), stepUpChallenge{
+					description: "A different authentication level is required",
+					acr:         acr,
+					maxAge:      maxAge,
+				})
+				return
+			}
+
+			if maxAge > 0 && (au.time.IsZero() || time.Since(au.time) > maxAge) {
+				a.stepUpRequiredException(w, r, "authentication is too old", stepUpChallenge{
+					description: "More recent authentication is required",
+					acr:         acr,
+					maxAge:      maxAge,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
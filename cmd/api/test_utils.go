@@ -1,11 +1,19 @@
 package main
 
 import (
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/lostxs/BackDev-test/internal/auth"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/mailer"
 	"github.com/lostxs/BackDev-test/internal/store"
 )
 
@@ -16,10 +24,18 @@ func newTestApplication(t *testing.T, cfg config) *app {
 
 	testAuth := auth.NewTestAuthenticator()
 
+	templates, err := mailer.NewTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	return &app{
 		config:        cfg,
+		logger:        logging.New(io.Discard, slog.LevelDebug),
 		store:         mockStore,
 		authenticator: testAuth,
+		mailer:        mailer.NewMemoryMailer(),
+		templates:     templates,
 	}
 }
 
@@ -35,3 +51,20 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 		t.Errorf("Expected response code %d. Got %d", expected, actual)
 	}
 }
+
+func newTestAccessToken(t *testing.T, app *app, userID string, permissions ...string) string {
+	t.Helper()
+
+	token, err := app.authenticator.GenerateAccessToken(jwt.MapClaims{
+		"sub":         userID,
+		"ip_address":  "127.0.0.1",
+		"permissions": permissions,
+		"scope":       strings.Join(permissions, " "),
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/tlsconfig"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key,
+// it returns the certificate.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return cert
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	first := writeCertificate(t, certFile, keyFile, "first")
+
+	suites, err := tlsconfig.ParseCipherPolicy(tlsconfig.PolicyIntermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		addr: freeAddr(t),
+		tls: tlsconfig.Config{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			MinVersion:   tls.VersionTLS12,
+			CipherSuites: suites,
+		},
+	}
+	app := newTestApplication(t, cfg)
+
+	userID := "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	certs, err := tlsconfig.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.tls, err = tlsconfig.New(cfg.tls, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go certs.Watch(ctx, 10*time.Millisecond)
+	go app.run(ctx, app.mount())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}
+	client := &http.Client{Transport: transport}
+	url := "https://" + cfg.addr
+
+	var res *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		res, err = client.Get(url + "/api/auth/tokens?user_id=" + userID)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	res.Body.Close()
+
+	t.Run("should serve HTTP/2", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+		if res.ProtoMajor != 2 {
+			t.Errorf("expected HTTP/2, got %s", res.Proto)
+		}
+	})
+
+	t.Run("should mark cookies secure", func(t *testing.T) {
+		var refreshTokenCookie *http.Cookie
+		for _, c := range res.Cookies() {
+			if c.Name == "refresh_token" {
+				refreshTokenCookie = c
+			}
+		}
+
+		if refreshTokenCookie == nil {
+			t.Fatalf("expected refresh_token cookie to be set")
+		}
+		if !refreshTokenCookie.Secure {
+			t.Errorf("expected refresh_token cookie to be Secure")
+		}
+	})
+
+	t.Run("should reload the certificate", func(t *testing.T) {
+		second := writeCertificate(t, certFile, keyFile, "second")
+		future := time.Now().Add(time.Minute)
+		for _, path := range []string{certFile, keyFile} {
+			if err := os.Chtimes(path, future, future); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		roots.AddCert(second)
+		for deadline := time.Now().Add(5 * time.Second); ; {
+			transport.CloseIdleConnections()
+			res, err := client.Get(url + "/healthz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.TLS.PeerCertificates[0].Subject.CommonName == "second" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expected the new certificate to be served")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
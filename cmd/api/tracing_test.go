@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// The global tracer provider can be set only once for tracers that already
+// exist, so every run shares the recorder.
+var (
+	spanRecorder     = tracetest.NewSpanRecorder()
+	setTracingGlobal sync.Once
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	setTracingGlobal.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	recorded := len(spanRecorder.Ended())
+
+	app := newTestApplication(t, config{})
+
+	userID := "86990727-379a-42ea-a71d-69179969e777"
+	app.store.Users.(*store.MockUserStore).Create(context.Background(), nil, &store.User{
+		ID:    userID,
+		Email: "test@test.com",
+	})
+
+	mux := app.mount()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	req, err := http.NewRequest(http.MethodGet, "/api/auth/tokens?user_id="+userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.RemoteAddr = "127.0.0.1:8080"
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spanRecorder.Ended()[recorded:] {
+		spans[span.Name()] = span
+	}
+
+	server, ok := spans["GET /api/auth/tokens"]
+	if !ok {
+		t.Fatalf("expected a span named after the route, got %v", spans)
+	}
+
+	t.Run("should continue the incoming trace", func(t *testing.T) {
+		if got := server.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("expected trace id %s, got %s", traceID, got)
+		}
+		if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+			t.Errorf("expected parent span 00f067aa0ba902b7, got %s", got)
+		}
+	})
+
+	t.Run("should trace bcrypt inside the request", func(t *testing.T) {
+		hash, ok := spans["bcrypt.GenerateFromPassword"]
+		if !ok {
+			t.Fatalf("expected a bcrypt span, got %v", spans)
+		}
+		if hash.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("expected bcrypt span to be a child of the request span")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lostxs/BackDev-test/internal/logging"
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/webhook"
+)
+
+// webhookMessages fans an event out to one outbox message per subscribed
+// endpoint, so each endpoint is retried independently.
+func (a *app) webhookMessages(ctx context.Context, eventType string, data map[string]any) ([]*store.OutboxMessage, error) {
+	endpoints, err := a.store.Webhooks.ListSubscribed(ctx, eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	event := webhook.Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+
+	messages := make([]*store.OutboxMessage, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		payload, err := json.Marshal(webhook.Delivery{
+			EndpointID: endpoint.ID,
+			Event:      event,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, &store.OutboxMessage{
+			IdempotencyKey: "webhook." + event.ID + "." + endpoint.ID,
+			Kind:           store.OutboxKindWebhook,
+			Payload:        payload,
+		})
+	}
+
+	return messages, nil
+}
+
+// enqueue stores messages that are not tied to another change, it never fails
+// the request.
+func (a *app) enqueue(r *http.Request, messages []*store.OutboxMessage) {
+	if len(messages) == 0 {
+		return
+	}
+	if err := a.store.Outbox.Create(r.Context(), messages...); err != nil {
+		logging.FromContext(r.Context()).Error("enqueue outbox messages", "error", err)
+	}
+}
+
+// dispatchWebhook enqueues an event that is not tied to another change, it
+// never fails the request.
+func (a *app) dispatchWebhook(r *http.Request, eventType string, data map[string]any) {
+	messages, err := a.webhookMessages(r.Context(), eventType, data)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("dispatch webhook", "event", eventType, "error", err)
+		return
+	}
+
+	a.enqueue(r, messages)
+}
@@ -0,0 +1,3 @@
+ALTER TABLE users
+ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+ADD COLUMN disabled_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+INSERT INTO permissions (name) VALUES ('users:impersonate');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'users:impersonate';
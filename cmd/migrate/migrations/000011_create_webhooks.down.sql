@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'webhooks:manage';
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_endpoints;
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN ip_change_policy;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN ip_change_policy VARCHAR(16);
@@ -0,0 +1,5 @@
+ALTER TABLE audit_events DROP COLUMN location;
+
+ALTER TABLE sessions
+DROP COLUMN location,
+DROP COLUMN updated_at;
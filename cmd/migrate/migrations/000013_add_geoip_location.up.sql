@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+ADD COLUMN location JSONB,
+ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+ALTER TABLE audit_events ADD COLUMN location JSONB;
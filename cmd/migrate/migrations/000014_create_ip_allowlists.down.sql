@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE name = 'organizations:manage';
+DROP TABLE IF EXISTS ip_allowlist_entries;
+ALTER TABLE users DROP COLUMN organization_id;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS ip_allowlist_entries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    cidr CIDR NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((user_id IS NULL) <> (organization_id IS NULL))
+);
+
+CREATE INDEX idx_ip_allowlist_entries_user_id ON ip_allowlist_entries (user_id);
+CREATE INDEX idx_ip_allowlist_entries_organization_id ON ip_allowlist_entries (organization_id);
+
+INSERT INTO permissions (name) VALUES ('organizations:manage');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'organizations:manage';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_events_subject_created_at;
+ALTER TABLE sessions DROP COLUMN ip_address;
+DROP TABLE IF EXISTS user_devices;
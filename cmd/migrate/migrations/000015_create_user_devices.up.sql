@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_devices (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint VARCHAR(64) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, fingerprint)
+);
+
+ALTER TABLE sessions ADD COLUMN ip_address VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_audit_events_subject_created_at ON audit_events (subject_id, created_at);
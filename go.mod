@@ -3,10 +3,45 @@ module github.com/lostxs/BackDev-test
 go 1.23.4
 
 require (
+	github.com/BurntSushi/toml v1.4.0 // direct
 	github.com/go-chi/chi/v5 v5.1.0 // direct
 	github.com/golang-jwt/jwt/v5 v5.2.1 // direct
 	github.com/google/uuid v1.6.0 // direct
 	github.com/joho/godotenv v1.5.1 // direct
 	github.com/lib/pq v1.10.9 // direct
-	golang.org/x/crypto v0.31.0 // direct
+	github.com/oschwald/maxminddb-golang v1.13.1 // direct
+	github.com/prometheus/client_golang v1.20.5 // direct
+	go.opentelemetry.io/otel v1.34.0 // direct
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.34.0 // direct
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.34.0 // direct
+	go.opentelemetry.io/otel/sdk v1.34.0 // direct
+	go.opentelemetry.io/otel/trace v1.34.0 // direct
+	golang.org/x/crypto v0.32.0 // direct
+	gopkg.in/yaml.v3 v3.0.1 // direct
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.25.1 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.34.0 // indirect
+	go.opentelemetry.io/otel/metric v1.34.0 // indirect
+	go.opentelemetry.io/proto/otlp v1.5.0 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20250115164207-1a7da9e5054f // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
+	google.golang.org/grpc v1.69.4 // indirect
+	google.golang.org/protobuf v1.36.3 // indirect
 )
@@ -1,9 +1,44 @@
 package auth
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type Authenticator interface {
 	GenerateAccessToken(claims jwt.Claims) (string, error)
 	ValidateAccessToken(token string) (*jwt.Token, error)
 	GenerateRefreshToken() (string, error)
 }
+
+// Authentication context class references for the "acr" claim, from the
+// weakest to the strongest.
+const (
+	ACRSingleFactor = "1"
+	ACRMultiFactor  = "2"
+)
+
+var acrLevels = []string{ACRSingleFactor, ACRMultiFactor}
+
+// AMRUserID is the "amr" value of tokens issued by user ID. It is not an
+// RFC 8176 method, stronger methods should use the registered values.
+const AMRUserID = "user_id"
+
+func ParseACR(s string) (string, error) {
+	if s != "" && !slices.Contains(acrLevels, s) {
+		return "", fmt.Errorf("unknown acr %q", s)
+	}
+	return s, nil
+}
+
+// ACRSatisfies reports whether acr is at least the required level. Every acr,
+// even an empty one, satisfies an empty requirement.
+func ACRSatisfies(acr, required string) bool {
+	if required == "" {
+		return true
+	}
+	return slices.Index(acrLevels, acr) >= slices.Index(acrLevels, required) &&
+		slices.Contains(acrLevels, acr)
+}
@@ -0,0 +1,133 @@
+package clientip
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver extracts the client address of a request. Forwarding headers are
+// only honoured when the request comes from a trusted proxy, and the chain is
+// walked from the right so a client cannot spoof its address by prepending
+// entries. The zero value trusts no proxies and returns the peer address.
+type Resolver struct {
+	TrustedProxies []netip.Prefix
+}
+
+// ParsePrefixes parses a comma separated list of CIDRs or single addresses.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", field)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", field)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// ClientIP returns the client address without a port, or RemoteAddr as is if
+// it cannot be parsed.
+func (res Resolver) ClientIP(r *http.Request) string {
+	peer, ok := ParseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	client := peer
+	if !res.trusted(peer) {
+		return client.String()
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := ParseAddr(hops[i])
+		if !ok {
+			break
+		}
+
+		client = addr
+		if !res.trusted(addr) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (res Resolver) trusted(addr netip.Addr) bool {
+	for _, prefix := range res.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the hops of the Forwarded header, falling back to
+// X-Forwarded-For, ordered from the client to the closest proxy.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+
+	for _, value := range h.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(val, `"`)
+				}
+			}
+			// Elements without for= still count as a hop, so an unparseable
+			// entry stops the walk instead of being skipped.
+			hops = append(hops, hop)
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
+
+// ParseAddr accepts an address with or without a port, in brackets for IPv6,
+// and unmaps IPv4-mapped IPv6 addresses.
+func ParseAddr(s string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
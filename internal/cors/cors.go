@@ -0,0 +1,301 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Origins is an allowlist of exact origins such as https://app.example.com,
+// wildcard subdomains such as https://*.example.com, or "*" for any origin.
+type Origins struct {
+	any       bool
+	exact     []string
+	wildcards []wildcard
+}
+
+// wildcard matches hosts ending in suffix, which includes the leading dot
+// and the port, so the apex domain and other ports do not match.
+type wildcard struct {
+	scheme string
+	suffix string
+}
+
+func ParseOrigins(list []string) (Origins, error) {
+	var o Origins
+	for _, origin := range list {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			o.any = true
+			continue
+		}
+
+		scheme, host, err := parseOrigin(origin)
+		if err != nil {
+			return Origins{}, err
+		}
+
+		if rest, ok := strings.CutPrefix(host, "*."); ok {
+			if rest == "" || strings.Contains(rest, "*") {
+				return Origins{}, fmt.Errorf("invalid wildcard origin %q", origin)
+			}
+			o.wildcards = append(o.wildcards, wildcard{scheme: scheme, suffix: "." + rest})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return Origins{}, fmt.Errorf("invalid wildcard origin %q, use scheme://*.domain", origin)
+		}
+		o.exact = append(o.exact, scheme+"://"+host)
+	}
+	return o, nil
+}
+
+// parseOrigin returns the lowercase scheme and host of a serialized origin,
+// which has no path, query or credentials.
+func parseOrigin(origin string) (scheme, host string, err error) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", fmt.Errorf("invalid origin %q, use scheme://host[:port]", origin)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("invalid origin %q, use http or https", origin)
+	}
+	return strings.ToLower(u.Scheme), strings.ToLower(u.Host), nil
+}
+
+// Any reports whether every origin is allowed.
+func (o Origins) Any() bool {
+	return o.any
+}
+
+// Empty reports whether no origin is allowed.
+func (o Origins) Empty() bool {
+	return !o.any && len(o.exact) == 0 && len(o.wildcards) == 0
+}
+
+// Match reports whether origin is listed, "*" matches any origin.
+func (o Origins) Match(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if o.any {
+		return true
+	}
+
+	scheme, host, err := parseOrigin(origin)
+	if err != nil {
+		return false
+	}
+	if slices.Contains(o.exact, scheme+"://"+host) {
+		return true
+	}
+	for _, w := range o.wildcards {
+		if scheme == w.scheme && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy decides which cross-origin requests browsers may make.
+type Policy struct {
+	Origins Origins
+	// Methods and Headers are allowed in preflight requests, header names
+	// are case-insensitive.
+	Methods []string
+	Headers []string
+	// ExposedHeaders are readable by scripts besides the safelisted ones.
+	ExposedHeaders []string
+	// Credentials lets browsers send cookies and read the response, the
+	// allowed origin is then always named, never "*".
+	Credentials bool
+	// MaxAge caches preflight responses, zero leaves it to the browser.
+	MaxAge time.Duration
+}
+
+func (p Policy) validate() error {
+	if p.Credentials && p.Origins.Any() {
+		return errors.New("credentials cannot be allowed for any origin")
+	}
+	return nil
+}
+
+// Route overrides the methods and credentials of the default policy for
+// Path and everything below it.
+type Route struct {
+	Path        string
+	Methods     []string
+	Credentials bool
+}
+
+// ParseRoutes parses routes such as "/api/auth/refresh POST credentials", a
+// path followed by its methods and, to allow credentials, "credentials".
+func ParseRoutes(list []string) ([]Route, error) {
+	var routes []Route
+	for _, item := range list {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+
+		r := Route{Path: strings.TrimSuffix(fields[0], "/")}
+		if !strings.HasPrefix(fields[0], "/") || r.Path == "" {
+			return nil, fmt.Errorf("invalid route %q, the path must start with / and not be the root", item)
+		}
+		if slices.ContainsFunc(routes, func(other Route) bool { return other.Path == r.Path }) {
+			return nil, fmt.Errorf("duplicate route %q", r.Path)
+		}
+
+		for _, field := range fields[1:] {
+			switch {
+			case field == "credentials":
+				r.Credentials = true
+			case slices.Contains(methods, field):
+				r.Methods = append(r.Methods, field)
+			default:
+				return nil, fmt.Errorf("invalid route %q, unknown method or option %q", item, field)
+			}
+		}
+		if len(r.Methods) == 0 {
+			return nil, fmt.Errorf("invalid route %q, list at least one method", item)
+		}
+
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+type route struct {
+	prefix string
+	policy Policy
+}
+
+// CORS applies a default policy, or the override of the longest route
+// prefix that matches the request path.
+type CORS struct {
+	policy Policy
+	routes []route
+}
+
+// New returns a CORS with policy as the default and overrides keyed by path,
+// a path also covers everything below it.
+func New(policy Policy, overrides map[string]Policy) (*CORS, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	c := &CORS{policy: policy}
+	for prefix, override := range overrides {
+		if err := override.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", prefix, err)
+		}
+		c.routes = append(c.routes, route{prefix: strings.TrimSuffix(prefix, "/"), policy: override})
+	}
+	slices.SortFunc(c.routes, func(a, b route) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+	return c, nil
+}
+
+func (c *CORS) policyFor(path string) Policy {
+	for _, route := range c.routes {
+		if path == route.prefix || strings.HasPrefix(path, route.prefix+"/") {
+			return route.policy
+		}
+	}
+	return c.policy
+}
+
+// AllowsCredentials reports whether the origin of r may send credentials to
+// its path.
+func (c *CORS) AllowsCredentials(r *http.Request) bool {
+	policy := c.policyFor(r.URL.Path)
+	return policy.Credentials && policy.Origins.Match(r.Header.Get("Origin"))
+}
+
+// Handler answers preflight requests and adds CORS headers to responses for
+// allowed origins, other requests pass through without them.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.policyFor(r.URL.Path)
+		origin := r.Header.Get("Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+			if policy.Origins.Match(origin) && policy.preflight(w.Header(), r) {
+				policy.allowOrigin(w.Header(), origin)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if policy.Origins.Match(origin) {
+			policy.allowOrigin(w.Header(), origin)
+			if len(policy.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p Policy) allowOrigin(h http.Header, origin string) {
+	if p.Origins.Any() && !p.Credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight sets the allowed method and headers, it reports false when the
+// request asks for more than the policy allows.
+func (p Policy) preflight(h http.Header, r *http.Request) bool {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !slices.Contains(p.Methods, method) {
+		return false
+	}
+
+	var headers []string
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if !slices.ContainsFunc(p.Headers, func(allowed string) bool { return strings.EqualFold(allowed, header) }) {
+			return false
+		}
+		headers = append(headers, header)
+	}
+
+	h.Set("Access-Control-Allow-Methods", method)
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	return true
+}
@@ -26,6 +26,12 @@ func Seed(store store.Storage, db *sql.DB) {
 			log.Println("Error creating user:", err)
 			return
 		}
+
+		if err := store.Roles.AssignToUser(ctx, tx, user.ID, roleFor(user.Email)); err != nil {
+			_ = tx.Rollback()
+			log.Println("Error assigning role:", err)
+			return
+		}
 	}
 
 	tx.Commit()
@@ -44,3 +50,10 @@ func generateUsers(num int) []*store.User {
 
 	return users
 }
+
+func roleFor(email string) string {
+	if email == "admin@example.com" {
+		return "admin"
+	}
+	return "user"
+}
@@ -2,8 +2,6 @@ package env
 
 import (
 	"os"
-	"strconv"
-	"time"
 )
 
 func GetString(key string, fallback string) string {
@@ -14,31 +12,3 @@ func GetString(key string, fallback string) string {
 
 	return val
 }
-
-func GetInt(key string, fallback int) int {
-	val, ok := os.LookupEnv(key)
-	if !ok {
-		return fallback
-	}
-
-	valInt, err := strconv.Atoi(val)
-	if err != nil {
-		return fallback
-	}
-
-	return valInt
-}
-
-func GetDuration(key string, fallback time.Duration) time.Duration {
-	val, ok := os.LookupEnv(key)
-	if !ok {
-		return fallback
-	}
-
-	duration, err := time.ParseDuration(val)
-	if err != nil {
-		return fallback
-	}
-
-	return duration
-}
@@ -0,0 +1,292 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of a setting, each one overrides the previous.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+const redacted = "[REDACTED]"
+
+// Loader reads settings from a config file, then environment variables, then
+// command line flags. Settings are named after their environment variable,
+// nested file keys and flag names map onto that name: db.max_open_conns in
+// the file and --db-max-open-conns both set DB_MAX_OPEN_CONNS.
+//
+// Invalid values are collected rather than replaced by their fallback, Err
+// reports all of them at once.
+type Loader struct {
+	file      map[string]string
+	flags     map[string]string
+	lookupEnv func(string) (string, bool)
+	settings  map[string]setting
+	errs      []error
+}
+
+type setting struct {
+	value  string
+	source string
+	redact func(string) string
+}
+
+// NewLoader parses args as --name=value flags, a bare --name is true, and
+// reads the YAML or TOML file named by CONFIG_FILE.
+func NewLoader(args []string, lookupEnv func(string) (string, bool)) (*Loader, error) {
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Loader{
+		flags:     flags,
+		lookupEnv: lookupEnv,
+		settings:  make(map[string]setting),
+	}
+
+	if path := l.String("CONFIG_FILE", ""); path != "" {
+		l.file, err = readFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+func parseFlags(args []string) (map[string]string, error) {
+	flags := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, ok := strings.CutPrefix(arg, "--")
+		if !ok {
+			name, ok = strings.CutPrefix(arg, "-")
+		}
+		if !ok || name == "" {
+			return nil, fmt.Errorf("unexpected argument %q, flags are --name=value", arg)
+		}
+
+		name, value, ok := strings.Cut(name, "=")
+		if !ok {
+			value = "true"
+		}
+		flags[keyName(name)] = value
+	}
+	return flags, nil
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var tree map[string]any
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]string)
+	flatten(settings, "", tree)
+	return settings, nil
+}
+
+// flatten joins nested keys with underscores, lists become comma-separated.
+func flatten(dst map[string]string, prefix string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for name, child := range v {
+			key := keyName(name)
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			flatten(dst, key, child)
+		}
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		dst[prefix] = strings.Join(items, ",")
+	case nil:
+		dst[prefix] = ""
+	default:
+		dst[prefix] = fmt.Sprint(v)
+	}
+}
+
+func keyName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// Flag reports whether a command flag such as --print-config is set, it is
+// not a setting and is neither printed nor read from the file or env.
+func (l *Loader) Flag(name string) bool {
+	key := keyName(name)
+	value, ok := l.flags[key]
+	if !ok {
+		return false
+	}
+	delete(l.flags, key)
+
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("--%s: %w", name, err))
+	}
+	return set
+}
+
+func (l *Loader) lookup(key, fallback string, redact func(string) string) string {
+	s := setting{value: fallback, source: SourceDefault, redact: redact}
+	if value, ok := l.flags[key]; ok {
+		s.value, s.source = value, SourceFlag
+	} else if value, ok := l.lookupEnv(key); ok {
+		s.value, s.source = value, SourceEnv
+	} else if value, ok := l.file[key]; ok {
+		s.value, s.source = value, SourceFile
+	}
+
+	l.settings[key] = s
+	return s.value
+}
+
+func (l *Loader) String(key, fallback string) string {
+	return l.lookup(key, fallback, nil)
+}
+
+// Secret is a String that Print redacts.
+func (l *Loader) Secret(key, fallback string) string {
+	return l.lookup(key, fallback, func(string) string { return redacted })
+}
+
+// URL is a String whose password Print redacts, such as a database URI.
+func (l *Loader) URL(key, fallback string) string {
+	return l.lookup(key, fallback, func(value string) string {
+		u, err := url.Parse(value)
+		if err != nil {
+			return redacted
+		}
+		return u.Redacted()
+	})
+}
+
+// List splits a comma-separated String, ignoring empty items.
+func (l *Loader) List(key, fallback string) []string {
+	var items []string
+	for _, item := range strings.Split(l.String(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (l *Loader) Int(key string, fallback int) int {
+	return parse(l, key, fallback, strconv.Atoi)
+}
+
+func (l *Loader) Float(key string, fallback float64) float64 {
+	return parse(l, key, fallback, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+}
+
+func (l *Loader) Duration(key string, fallback time.Duration) time.Duration {
+	return parse(l, key, fallback, time.ParseDuration)
+}
+
+func (l *Loader) Bool(key string, fallback bool) bool {
+	return parse(l, key, fallback, strconv.ParseBool)
+}
+
+func parse[T any](l *Loader, key string, fallback T, parseValue func(string) (T, error)) T {
+	value := l.lookup(key, fmt.Sprint(fallback), nil)
+	if l.settings[key].source == SourceDefault {
+		return fallback
+	}
+
+	parsed, err := parseValue(value)
+	if err != nil {
+		l.Check(key, fmt.Errorf("invalid value %q", value))
+		return fallback
+	}
+	return parsed
+}
+
+// Check records err as a validation error of key.
+func (l *Loader) Check(key string, err error) {
+	if err == nil {
+		return
+	}
+	source := SourceDefault
+	if s, ok := l.settings[key]; ok {
+		source = s.source
+	}
+	l.errs = append(l.errs, fmt.Errorf("%s (%s): %w", key, source, err))
+}
+
+// Err joins every invalid value and validation error, along with file keys
+// and flags that no setting reads.
+func (l *Loader) Err() error {
+	errs := slices.Clone(l.errs)
+	for _, unknown := range []struct {
+		values map[string]string
+		source string
+	}{{l.file, SourceFile}, {l.flags, SourceFlag}} {
+		for _, key := range sortedKeys(unknown.values) {
+			if _, ok := l.settings[key]; !ok {
+				errs = append(errs, fmt.Errorf("%s (%s): unknown setting", key, unknown.source))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes every setting read so far in .env format, annotated with its
+// source and with secrets redacted.
+func (l *Loader) Print(w io.Writer) error {
+	for _, key := range sortedKeys(l.settings) {
+		s := l.settings[key]
+		value := s.value
+		if s.redact != nil && value != "" {
+			value = s.redact(value)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s # %s\n", key, strconv.Quote(value), s.source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
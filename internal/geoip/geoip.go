@@ -0,0 +1,190 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var ErrInvalidIP = errors.New("invalid ip address")
+
+// Location is what the databases know about an address, any field may be
+// empty depending on the database edition.
+type Location struct {
+	Country      string       `json:"country,omitempty"`
+	City         string       `json:"city,omitempty"`
+	ASN          uint         `json:"asn,omitempty"`
+	Organization string       `json:"organization,omitempty"`
+	Coordinates  *Coordinates `json:"coordinates,omitempty"`
+}
+
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// AccuracyRadius is in kilometers.
+	AccuracyRadius uint16 `json:"accuracy_radius,omitempty"`
+}
+
+func (l *Location) String() string {
+	var parts []string
+	if l.City != "" {
+		parts = append(parts, l.City)
+	}
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+
+	s := strings.Join(parts, ", ")
+	if l.ASN != 0 {
+		s = strings.TrimSpace(fmt.Sprintf("%s (AS%d %s)", s, l.ASN, l.Organization))
+	}
+	return s
+}
+
+// Locator resolves an address to a location, a nil location means the address
+// is not in the database.
+type Locator interface {
+	Lookup(ip string) (*Location, error)
+}
+
+// Reader looks addresses up in one or more MaxMind-format databases, e.g.
+// GeoLite2-City and GeoLite2-ASN, merging the results.
+type Reader struct {
+	dbs []*maxminddb.Reader
+}
+
+// record covers the City, Country and ASN database layouts.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude       *float64 `maxminddb:"latitude"`
+		Longitude      *float64 `maxminddb:"longitude"`
+		AccuracyRadius uint16   `maxminddb:"accuracy_radius"`
+	} `maxminddb:"location"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+func Open(paths ...string) (*Reader, error) {
+	reader := &Reader{}
+	for _, path := range paths {
+		db, err := maxminddb.Open(path)
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("geoip: %s: %w", path, err)
+		}
+		reader.dbs = append(reader.dbs, db)
+	}
+
+	return reader, nil
+}
+
+func (r *Reader) Lookup(ip string) (*Location, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, ErrInvalidIP
+	}
+
+	var location *Location
+	for _, db := range r.dbs {
+		var rec record
+		network, ok, err := db.LookupNetwork(addr, &rec)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || network == nil {
+			continue
+		}
+
+		if location == nil {
+			location = &Location{}
+		}
+		if rec.Country.ISOCode != "" {
+			location.Country = rec.Country.ISOCode
+		}
+		if name := rec.City.Names["en"]; name != "" {
+			location.City = name
+		}
+		if rec.ASN != 0 {
+			location.ASN = rec.ASN
+			location.Organization = rec.Organization
+		}
+		if rec.Location.Latitude != nil && rec.Location.Longitude != nil {
+			location.Coordinates = &Coordinates{
+				Latitude:       *rec.Location.Latitude,
+				Longitude:      *rec.Location.Longitude,
+				AccuracyRadius: rec.Location.AccuracyRadius,
+			}
+		}
+	}
+
+	return location, nil
+}
+
+func (r *Reader) Close() error {
+	var errs []error
+	for _, db := range r.dbs {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+const earthRadius = 6371.0
+
+// Distance returns the great-circle distance between two points in kilometers.
+func Distance(a, b *Coordinates) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Travel describes the movement between two sign-ins.
+type Travel struct {
+	Distance float64 `json:"distance_km"`
+	Speed    float64 `json:"speed_kmh"`
+}
+
+// Measure returns the travel between two locations in the elapsed time, ok is
+// false when either has no coordinates. Accuracy radii are subtracted from the
+// distance so imprecise lookups do not look like movement.
+func Measure(from, to *Location, elapsed time.Duration) (travel Travel, ok bool) {
+	if from == nil || to == nil || from.Coordinates == nil || to.Coordinates == nil {
+		return Travel{}, false
+	}
+
+	distance := Distance(from.Coordinates, to.Coordinates) -
+		float64(from.Coordinates.AccuracyRadius) - float64(to.Coordinates.AccuracyRadius)
+	if distance <= 0 {
+		return Travel{}, true
+	}
+
+	// Refreshes in quick succession would otherwise divide by almost zero.
+	hours := math.Max(elapsed.Hours(), time.Minute.Hours())
+	return Travel{Distance: math.Round(distance), Speed: math.Round(distance / hours)}, true
+}
+
+// ImpossibleTravel reports whether going from one location to another in the
+// elapsed time requires a speed above maxSpeed (km/h), a zero maxSpeed
+// disables the check.
+func ImpossibleTravel(from, to *Location, elapsed time.Duration, maxSpeed float64) (Travel, bool) {
+	if maxSpeed <= 0 {
+		return Travel{}, false
+	}
+
+	travel, ok := Measure(from, to, elapsed)
+	return travel, ok && travel.Speed > maxSpeed
+}
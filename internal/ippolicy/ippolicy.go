@@ -0,0 +1,72 @@
+package ippolicy
+
+import (
+	"fmt"
+
+	"github.com/lostxs/BackDev-test/internal/clientip"
+)
+
+// Policy decides what happens when a session is refreshed from a network
+// other than the one the access token was issued to.
+type Policy string
+
+const (
+	Ignore        Policy = "ignore"
+	Notify        Policy = "notify"
+	RequireReauth Policy = "require_reauth"
+	Deny          Policy = "deny"
+)
+
+func Parse(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Ignore, Notify, RequireReauth, Deny:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid ip change policy %q", s)
+	}
+}
+
+var severity = map[Policy]int{Ignore: 1, Notify: 2, RequireReauth: 3, Deny: 4}
+
+// Stricter returns the more restrictive of two policies.
+func Stricter(a, b Policy) Policy {
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+// Matcher compares addresses by network rather than exact value, so clients
+// of mobile carriers that hop within a prefix are not flagged. A zero prefix
+// compares full addresses.
+type Matcher struct {
+	IPv4Prefix int
+	IPv6Prefix int
+}
+
+func (m Matcher) SameNetwork(a, b string) bool {
+	addrA, okA := clientip.ParseAddr(a)
+	addrB, okB := clientip.ParseAddr(b)
+	if !okA || !okB {
+		return a == b
+	}
+
+	if addrA.Is4() != addrB.Is4() {
+		return false
+	}
+
+	bits := m.IPv6Prefix
+	if addrA.Is4() {
+		bits = m.IPv4Prefix
+	}
+	if bits <= 0 || bits > addrA.BitLen() {
+		bits = addrA.BitLen()
+	}
+
+	prefix, err := addrA.Prefix(bits)
+	if err != nil {
+		return false
+	}
+
+	return prefix.Contains(addrB)
+}
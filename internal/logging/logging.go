@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys, compared case-insensitively, whose values
+// are never written. Header names are covered as well, see Headers.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"password":      true,
+	"secret":        true,
+}
+
+// secretPattern matches bearer credentials and JWTs inside free-form values
+// such as error messages.
+var secretPattern = regexp.MustCompile(`(?i)bearer\s+\S+|eyJ[\w-]+\.[\w-]+\.[\w-]*`)
+
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// New returns a JSON logger that redacts secrets.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: Redact,
+	}))
+}
+
+// Redact is a slog.HandlerOptions.ReplaceAttr that hides sensitive keys and
+// tokens embedded in strings and errors.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+
+	return a
+}
+
+func redactString(s string) string {
+	return secretPattern.ReplaceAllString(s, redacted)
+}
+
+// Headers logs a header set as a group, so sensitive headers are redacted
+// like any other key.
+func Headers(h http.Header) slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for name, values := range h {
+		attrs = append(attrs, slog.String(name, strings.Join(values, ", ")))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+type contextKey struct{}
+
+// scope is the logger of a single request, it is replaced in place so that
+// attributes added deep in the handler chain reach the final request log.
+type scope struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+}
+
+// WithContext returns a context carrying a request-scoped logger.
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &scope{logger: logger})
+}
+
+// FromContext returns the request-scoped logger, or the default one outside
+// of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return slog.Default()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logger
+}
+
+// With adds attributes to the request-scoped logger, it does nothing outside
+// of a request.
+func With(ctx context.Context, args ...any) {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = s.logger.With(args...)
+}
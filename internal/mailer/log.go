@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogMailer writes rendered messages to w instead of delivering them, it is
+// meant for local development.
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{
+		w:    w,
+		from: from,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	body, err := msg.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.w, "%s\n", body)
+	return err
+}
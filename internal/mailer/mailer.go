@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+var ErrNoRecipients = errors.New("mailer: message has no recipients")
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type Message struct {
+	// ID, when set, is rendered as the Message-ID so receivers can drop
+	// duplicates of a retried delivery.
+	ID      string   `json:"id,omitempty"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// Bytes renders the message as an RFC 5322 document ready for DATA.
+func (m *Message) Bytes(from string) ([]byte, error) {
+	if len(m.To) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	for _, addr := range append([]string{from}, m.To...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return nil, fmt.Errorf("mailer: invalid address %q: %w", addr, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if m.ID != "" {
+		fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", messageIDReplacer.Replace(m.ID), domainOf(from))
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n", mw.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageIDReplacer keeps ids within the dot-atom syntax of RFC 5322.
+var messageIDReplacer = strings.NewReplacer(":", ".", " ", ".", "<", "", ">", "", "@", ".", "\r", "", "\n", "")
+
+func domainOf(addr string) string {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return strings.TrimSuffix(addr[i+1:], ">")
+	}
+	return "localhost"
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+	// RequireTLS refuses to send when the server does not offer STARTTLS.
+	RequireTLS bool
+}
+
+type SMTPMailer struct {
+	config SMTPConfig
+	// envelopeFrom is the bare address of From for MAIL FROM, which takes
+	// no display name.
+	envelopeFrom string
+}
+
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: invalid from address %q: %w", config.From, err)
+	}
+
+	return &SMTPMailer{
+		config:       config,
+		envelopeFrom: from.Address,
+	}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	body, err := msg.Bytes(m.config.From)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("mailer: dial %s: %w", addr, err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{
+			ServerName: m.config.Host,
+			MinVersion: tls.VersionTLS12,
+		}); err != nil {
+			return fmt.Errorf("mailer: starttls: %w", err)
+		}
+	} else if m.config.RequireTLS {
+		return fmt.Errorf("mailer: %s does not support STARTTLS", addr)
+	}
+
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("mailer: auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(m.envelopeFrom); err != nil {
+		return fmt.Errorf("mailer: mail from: %w", err)
+	}
+
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("mailer: rcpt to %s: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: data: %w", err)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("mailer: write: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: data: %w", err)
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,211 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	TemplateIPChanged     = "ip_changed"
+	TemplateNewDevice     = "new_device"
+	TemplatePasswordReset = "password_reset"
+	TemplateVerification  = "verification"
+	TemplateLockout       = "lockout"
+	TemplateUnusualSignIn = "unusual_sign_in"
+
+	DefaultLocale = "en"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+var templateNames = []string{
+	TemplateIPChanged,
+	TemplateNewDevice,
+	TemplatePasswordReset,
+	TemplateVerification,
+	TemplateLockout,
+	TemplateUnusualSignIn,
+}
+
+// Templates renders notification emails from templates/<locale>/<name>.txt
+// and <name>.html. The text template defines "subject" and "body", the HTML
+// template defines "body".
+type Templates struct {
+	// templates is keyed by locale/name.
+	templates map[string]*template
+}
+
+type template struct {
+	text *texttemplate.Template
+	// html is nil when the locale has no HTML part.
+	html *htmltemplate.Template
+}
+
+// NewTemplates parses the embedded templates, files in dir take precedence so
+// operators can override single templates without rebuilding. Every template
+// is parsed here, so a broken override fails startup rather than a
+// notification.
+func NewTemplates(dir string) (*Templates, error) {
+	embedded, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []fs.FS{embedded}
+	fsys := embedded
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+		sources = append(sources, os.DirFS(dir))
+		fsys = overlayFS{os.DirFS(dir), embedded}
+	}
+
+	keys := make(map[string]bool)
+	for _, source := range sources {
+		if err := templateKeys(source, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &Templates{templates: make(map[string]*template)}
+	for key := range keys {
+		tmpl, err := parseTemplate(fsys, key)
+		if err != nil {
+			return nil, err
+		}
+		t.templates[key] = tmpl
+	}
+
+	for _, name := range templateNames {
+		if _, ok := t.templates[DefaultLocale+"/"+name]; !ok {
+			return nil, fmt.Errorf("mail template %s/%s.txt: missing", DefaultLocale, name)
+		}
+	}
+
+	return t, nil
+}
+
+// templateKeys adds the locale/name of every template file in fsys to keys,
+// files that are not templates are ignored.
+func templateKeys(fsys fs.FS, keys map[string]bool) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		locale, file, ok := strings.Cut(path, "/")
+		if !ok || strings.Contains(file, "/") {
+			return nil
+		}
+		name, ext, _ := strings.Cut(file, ".")
+		if ext != "txt" && ext != "html" {
+			return nil
+		}
+		if !slices.Contains(templateNames, name) {
+			return fmt.Errorf("mail template %s: unknown template %q", path, name)
+		}
+
+		keys[locale+"/"+name] = true
+		return nil
+	})
+}
+
+func parseTemplate(fsys fs.FS, key string) (*template, error) {
+	text, err := texttemplate.ParseFS(fsys, key+".txt")
+	if err != nil {
+		return nil, fmt.Errorf("mail template %s.txt: %w", key, err)
+	}
+	for _, name := range []string{"subject", "body"} {
+		if text.Lookup(name) == nil {
+			return nil, fmt.Errorf("mail template %s.txt: %q is not defined", key, name)
+		}
+	}
+
+	tmpl := &template{text: text}
+
+	if _, err := fs.Stat(fsys, key+".html"); errors.Is(err, fs.ErrNotExist) {
+		return tmpl, nil
+	}
+
+	html, err := htmltemplate.ParseFS(fsys, key+".html")
+	if err != nil {
+		return nil, fmt.Errorf("mail template %s.html: %w", key, err)
+	}
+	if html.Lookup("body") == nil {
+		return nil, fmt.Errorf("mail template %s.html: %q is not defined", key, "body")
+	}
+	tmpl.html = html
+
+	return tmpl, nil
+}
+
+// Render executes the named template in the best matching locale, falling
+// back from "ru-RU" to "ru" and then to DefaultLocale.
+func (t *Templates) Render(name, locale string, data any) (*Message, error) {
+	tmpl, ok := t.templates[t.resolveLocale(name, locale)+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("mail template %q not found", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()),
+	}
+	if tmpl.html == nil {
+		return msg, nil
+	}
+
+	var htmlBody bytes.Buffer
+	if err := tmpl.html.ExecuteTemplate(&htmlBody, "body", data); err != nil {
+		return nil, err
+	}
+	msg.HTML = strings.TrimSpace(htmlBody.String())
+
+	return msg, nil
+}
+
+func (t *Templates) resolveLocale(name, locale string) string {
+	candidates := []string{strings.ToLower(locale)}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, strings.ToLower(locale[:i]))
+	}
+
+	for _, candidate := range candidates {
+		if _, ok := t.templates[candidate+"/"+name]; ok && candidate != "" {
+			return candidate
+		}
+	}
+
+	return DefaultLocale
+}
+
+type overlayFS struct {
+	primary  fs.FS
+	fallback fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.primary.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.fallback.Open(name)
+	}
+	return f, err
+}
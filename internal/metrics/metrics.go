@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "backdev"
+
+var (
+	// TokensIssued counts access tokens handed out, by grant: create,
+	// refresh or impersonation.
+	TokensIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Access tokens issued, by grant.",
+	}, []string{"grant"})
+
+	Refreshes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refreshes_total",
+		Help:      "Successful token refreshes.",
+	})
+
+	// RefreshFailures counts failed refreshes by reason, see the Reason
+	// constants.
+	RefreshFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_failures_total",
+		Help:      "Failed token refreshes, by reason.",
+	}, []string{"reason"})
+
+	IPChangeAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ip_change_alerts_total",
+		Help:      "Refreshes from another network, by applied policy and impossible travel.",
+	}, []string{"policy", "impossible_travel"})
+
+	EmailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Email delivery attempts, by result.",
+	}, []string{"result"})
+
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Handler latency, by method, route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by the rate limiter, by route and key.",
+	}, []string{"route", "key"})
+
+	// BcryptDuration is observed for every hash, the cost makes it the
+	// dominant part of issuance and refresh latency.
+	BcryptDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bcrypt_duration_seconds",
+		Help:      "Time spent hashing refresh tokens with bcrypt.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 8),
+	})
+)
+
+// Refresh failure reasons.
+const (
+	ReasonExpired      = "expired"
+	ReasonInvalidToken = "invalid_token"
+	ReasonNotFound     = "not_found"
+	ReasonMismatch     = "mismatch"
+	ReasonIPChange     = "ip_change"
+	ReasonRisk         = "risk"
+	ReasonCSRF         = "csrf"
+	ReasonRateLimited  = "rate_limited"
+	ReasonOther        = "other"
+)
+
+// RegisterDB exposes the connection pool statistics of db.
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+type instrumentedMailer struct {
+	next mailer.Mailer
+}
+
+// InstrumentMailer counts the sends of next in EmailsSent.
+func InstrumentMailer(next mailer.Mailer) mailer.Mailer {
+	return instrumentedMailer{next: next}
+}
+
+func (m instrumentedMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	err := m.next.Send(ctx, msg)
+	if err != nil {
+		EmailsSent.WithLabelValues("failed").Inc()
+		return err
+	}
+
+	EmailsSent.WithLabelValues("sent").Inc()
+	return nil
+}
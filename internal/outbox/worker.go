@@ -0,0 +1,174 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/mailer"
+	"github.com/lostxs/BackDev-test/internal/store"
+	"github.com/lostxs/BackDev-test/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/lostxs/BackDev-test/internal/outbox")
+
+type Store interface {
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*store.OutboxMessage, error)
+	MarkSent(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error
+}
+
+type Config struct {
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease hides a claimed message from other workers while it is being
+	// delivered, it must be longer than the slowest handler can take.
+	Lease time.Duration
+}
+
+// Handler delivers a single message of one kind.
+type Handler func(ctx context.Context, msg *store.OutboxMessage) error
+
+// Worker delivers outbox messages, retrying failures with exponential backoff
+// until MaxAttempts is reached and the message is dead-lettered.
+type Worker struct {
+	store    Store
+	config   Config
+	handlers map[string]Handler
+}
+
+// NewWorker returns a worker that delivers email messages through mailer,
+// other kinds are registered with Handle.
+func NewWorker(s Store, m mailer.Mailer, config Config) *Worker {
+	w := &Worker{
+		store:    s,
+		config:   config,
+		handlers: make(map[string]Handler),
+	}
+
+	w.Handle(store.OutboxKindEmail, emailHandler(m))
+
+	return w
+}
+
+func (w *Worker) Handle(kind string, handler Handler) {
+	w.handlers[kind] = handler
+}
+
+// Run processes due messages every Interval until ctx is cancelled. A batch
+// in progress is finished rather than interrupted.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.ProcessDue(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("outbox: process due messages", "error", err)
+			}
+		}
+	}
+}
+
+// ProcessDue delivers up to BatchSize due messages and returns how many were
+// claimed. Messages are claimed one at a time, so a lease only has to outlive
+// the delivery it covers rather than the whole batch.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	for n := 0; n < w.config.BatchSize; n++ {
+		messages, err := w.store.ClaimDue(ctx, 1, w.config.Lease)
+		if err != nil || len(messages) == 0 {
+			return n, err
+		}
+
+		if err := w.process(ctx, messages[0]); err != nil {
+			return n + 1, err
+		}
+	}
+
+	return w.config.BatchSize, nil
+}
+
+func (w *Worker) process(ctx context.Context, msg *store.OutboxMessage) error {
+	if err := w.deliver(ctx, msg); err != nil {
+		var next *time.Time
+		if msg.Attempts+1 < w.config.MaxAttempts {
+			t := time.Now().Add(w.backoff(msg.Attempts))
+			next = &t
+		}
+
+		slog.Warn("outbox: deliver", "idempotency_key", msg.IdempotencyKey, "attempt", msg.Attempts+1, "error", err)
+		return w.store.MarkFailed(ctx, msg.ID, err.Error(), next)
+	}
+
+	return w.store.MarkSent(ctx, msg.ID)
+}
+
+// Flush delivers due messages batch by batch until none are left or ctx is
+// done and returns how many were claimed. It is meant for shutdown, after
+// Run has returned.
+func (w *Worker) Flush(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := w.ProcessDue(ctx)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// deliver runs the handler of the message kind in its own span, deliveries
+// happen after the request that enqueued them has finished.
+func (w *Worker) deliver(ctx context.Context, msg *store.OutboxMessage) error {
+	ctx, span := tracer.Start(ctx, "outbox.deliver", trace.WithAttributes(
+		attribute.String("outbox.kind", msg.Kind),
+		attribute.String("outbox.idempotency_key", msg.IdempotencyKey),
+		attribute.Int("outbox.attempt", msg.Attempts+1),
+	))
+
+	handler, ok := w.handlers[msg.Kind]
+	if !ok {
+		err := fmt.Errorf("unknown message kind %q", msg.Kind)
+		tracing.End(span, err)
+		return err
+	}
+
+	err := handler(ctx, msg)
+	tracing.End(span, err)
+	return err
+}
+
+func emailHandler(m mailer.Mailer) Handler {
+	return func(ctx context.Context, msg *store.OutboxMessage) error {
+		var email mailer.Message
+		if err := json.Unmarshal(msg.Payload, &email); err != nil {
+			return err
+		}
+		email.ID = msg.IdempotencyKey
+
+		return m.Send(ctx, &email)
+	}
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.config.BaseBackoff
+	for i := 0; i < attempts && d < w.config.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, w.config.MaxBackoff)
+}
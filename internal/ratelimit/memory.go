@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryBackend keeps buckets in process, each replica limits on its own.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryBackend) Take(ctx context.Context, key string, capacity, rate float64) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+func (m *MemoryBackend) Prune(ctx context.Context, maxIdle time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for key, b := range m.buckets {
+		if now.Sub(b.updatedAt) > maxIdle {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys a rule can count requests by.
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyClient = "client"
+)
+
+// Limit allows Requests per Period, in bursts of up to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// Rule limits the requests that share a key.
+type Rule struct {
+	Key   string
+	Limit Limit
+}
+
+// ParseRules parses comma-separated rules such as "ip:20/1m,client:5/1m", an
+// empty string disables limiting.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		key, limit, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %q, use key:requests/period", field)
+		}
+		switch key {
+		case KeyIP, KeyUser, KeyClient:
+		default:
+			return nil, fmt.Errorf("unknown key %q in rule %q, use %s, %s or %s", key, field, KeyIP, KeyUser, KeyClient)
+		}
+
+		requests, period, ok := strings.Cut(limit, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %q, use key:requests/period", field)
+		}
+		n, err := strconv.Atoi(requests)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid request count in rule %q", field)
+		}
+		d, err := time.ParseDuration(period)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid period in rule %q", field)
+		}
+
+		rules = append(rules, Rule{Key: key, Limit: Limit{Requests: n, Period: d}})
+	}
+	return rules, nil
+}
+
+// Backend keeps token buckets, a bucket holds at most capacity tokens and
+// refills at rate tokens per second.
+type Backend interface {
+	// Take refills the bucket of key and takes a token if one is left, it
+	// returns the tokens left afterwards.
+	Take(ctx context.Context, key string, capacity, rate float64) (tokens float64, allowed bool, err error)
+	// Prune drops buckets untouched for maxIdle, which have refilled by then.
+	Prune(ctx context.Context, maxIdle time.Duration) error
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is when the next request is allowed, zero if this one was.
+	RetryAfter time.Duration
+}
+
+type Limiter struct {
+	backend Backend
+}
+
+func NewLimiter(backend Backend) *Limiter {
+	return &Limiter{backend: backend}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds()
+
+	tokens, allowed, err := l.backend.Take(ctx, key, capacity, rate)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((capacity - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// PruneEvery prunes backend every interval until ctx is cancelled.
+func PruneEvery(ctx context.Context, backend Backend, interval, maxIdle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := backend.Prune(ctx, maxIdle); err != nil {
+				slog.Error("ratelimit: prune", "error", err)
+			}
+		}
+	}
+}
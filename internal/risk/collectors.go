@@ -0,0 +1,44 @@
+package risk
+
+import (
+	"context"
+
+	"github.com/lostxs/BackDev-test/internal/geoip"
+	"github.com/lostxs/BackDev-test/internal/ippolicy"
+)
+
+// NetworkCollector sets new_ip when the address left the network of the
+// previous session.
+func NetworkCollector(matcher ippolicy.Matcher) Collector {
+	return NewCollector(func(ctx context.Context, attempt *Attempt, signals Signals) error {
+		if attempt.PreviousIP != "" {
+			signals.SetBool(SignalNewIP, !matcher.SameNetwork(attempt.PreviousIP, attempt.IP))
+		}
+		return nil
+	}, SignalNewIP)
+}
+
+// GeoCollector compares the GeoIP locations of the previous and the current
+// session: new_asn, new_country and geo_velocity_kmh.
+func GeoCollector() Collector {
+	return NewCollector(func(ctx context.Context, attempt *Attempt, signals Signals) error {
+		prev, cur := attempt.PreviousLocation, attempt.Location
+		if prev == nil || cur == nil {
+			return nil
+		}
+
+		if prev.ASN != 0 && cur.ASN != 0 {
+			signals.SetBool(SignalNewASN, prev.ASN != cur.ASN)
+		}
+		if prev.Country != "" && cur.Country != "" {
+			signals.SetBool(SignalNewCountry, prev.Country != cur.Country)
+		}
+		if !attempt.PreviousSeen.IsZero() {
+			if travel, ok := geoip.Measure(prev, cur, attempt.Time.Sub(attempt.PreviousSeen)); ok {
+				signals[SignalGeoVelocity] = travel.Speed
+			}
+		}
+
+		return nil
+	}, SignalNewASN, SignalNewCountry, SignalGeoVelocity)
+}
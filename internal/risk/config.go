@@ -0,0 +1,181 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Config is the declarative rule set, usually loaded from a JSON file:
+//
+//	{
+//	  "timezone": "Europe/Moscow",
+//	  "failure_window": "1h",
+//	  "thresholds": {"notify": 20, "block": 80},
+//	  "rules": [
+//	    {"name": "new_device", "score": 20, "when": [{"signal": "new_device", "min": 1}]},
+//	    {"name": "night", "score": 10, "when": [{"signal": "hour", "min": 0, "max": 5}]}
+//	  ]
+//	}
+type Config struct {
+	Rules      []Rule     `json:"rules"`
+	Thresholds Thresholds `json:"thresholds"`
+	// Timezone is used for the hour signal, UTC when empty.
+	Timezone string `json:"timezone"`
+	// FailureWindow is how far back recent failures are counted.
+	FailureWindow Duration `json:"failure_window"`
+}
+
+// Thresholds map a score to a decision, the highest reached one wins. A zero
+// threshold disables that decision.
+type Thresholds struct {
+	Notify int `json:"notify"`
+	// StepUp must be zero. Token issuance is the only authentication and
+	// cannot raise acr, so there is no step-up to require; the field is read
+	// only to refuse configs that expect one.
+	StepUp int `json:"step_up"`
+	Block  int `json:"block"`
+}
+
+// Rule adds Score when all of its conditions match.
+type Rule struct {
+	Name       string      `json:"name"`
+	Score      int         `json:"score"`
+	Conditions []Condition `json:"when"`
+}
+
+// Condition matches when the signal is present and within [Min, Max], either
+// bound may be omitted. Boolean signals are 0 or 1.
+type Condition struct {
+	Signal string   `json:"signal"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// Duration reads Go duration strings such as "30m" from JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("risk: %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("risk: %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Thresholds.StepUp != 0 {
+		errs = append(errs, errors.New("thresholds: step_up is not supported, no authentication can satisfy it"))
+	}
+
+	levels := []int{c.Thresholds.Notify, c.Thresholds.Block}
+	last := 0
+	for _, level := range levels {
+		if level < 0 {
+			errs = append(errs, errors.New("thresholds must not be negative"))
+			break
+		}
+		if level == 0 {
+			continue
+		}
+		if level < last {
+			errs = append(errs, errors.New("thresholds must increase from notify to block"))
+			break
+		}
+		last = level
+	}
+
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %w", err))
+	}
+	if c.FailureWindow < 0 {
+		errs = append(errs, errors.New("failure_window must not be negative"))
+	}
+
+	names := map[string]bool{}
+	for i, rule := range c.Rules {
+		if rule.Name == "" {
+			errs = append(errs, fmt.Errorf("rule %d: name is required", i))
+			continue
+		}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("rule %q: duplicate name", rule.Name))
+		}
+		names[rule.Name] = true
+
+		if len(rule.Conditions) == 0 {
+			errs = append(errs, fmt.Errorf("rule %q: at least one condition is required", rule.Name))
+		}
+		for _, cond := range rule.Conditions {
+			if cond.Signal == "" {
+				errs = append(errs, fmt.Errorf("rule %q: condition without signal", rule.Name))
+			}
+			if cond.Min != nil && cond.Max != nil && *cond.Min > *cond.Max {
+				errs = append(errs, fmt.Errorf("rule %q: min is greater than max for %s", rule.Name, cond.Signal))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkSignals refuses conditions on signals that are never set, a misspelled
+// signal would otherwise never match.
+func (c *Config) checkSignals(known []string) error {
+	var errs []error
+	for _, rule := range c.Rules {
+		for _, cond := range rule.Conditions {
+			if cond.Signal != "" && !slices.Contains(known, cond.Signal) {
+				errs = append(errs, fmt.Errorf("rule %q: unknown signal %q", rule.Name, cond.Signal))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Condition) matches(signals Signals) bool {
+	value, ok := signals[c.Signal]
+	if !ok {
+		return false
+	}
+	if c.Min != nil && value < *c.Min {
+		return false
+	}
+	if c.Max != nil && value > *c.Max {
+		return false
+	}
+	return true
+}
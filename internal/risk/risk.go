@@ -0,0 +1,233 @@
+package risk
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/geoip"
+)
+
+type Decision string
+
+const (
+	Allow  Decision = "allow"
+	Notify Decision = "notify"
+	Block  Decision = "block"
+)
+
+// Signal names produced by the built-in collectors and the API.
+const (
+	SignalRefresh        = "refresh"
+	SignalNewDevice      = "new_device"
+	SignalNewIP          = "new_ip"
+	SignalNewASN         = "new_asn"
+	SignalNewCountry     = "new_country"
+	SignalGeoVelocity    = "geo_velocity_kmh"
+	SignalRecentFailures = "recent_failures"
+	SignalHour           = "hour"
+)
+
+// Signals are named numeric values, booleans are 0 or 1. A signal that could
+// not be determined is absent rather than zero, so rules do not match it.
+type Signals map[string]float64
+
+func (s Signals) SetBool(name string, value bool) {
+	if value {
+		s[name] = 1
+	} else {
+		s[name] = 0
+	}
+}
+
+// Attempt is a token issuance or refresh being assessed.
+type Attempt struct {
+	UserID    string
+	Refresh   bool
+	IP        string
+	UserAgent string
+	// DeviceID is a stable fingerprint of the client.
+	DeviceID string
+	Location *geoip.Location
+	// Previous* describe the user's last session, empty for the first one.
+	PreviousIP       string
+	PreviousLocation *geoip.Location
+	PreviousSeen     time.Time
+	Time             time.Time
+}
+
+// Collector adds signals for an attempt. The engine runs collectors in the
+// order they were registered. Signals lists every name the collector may set,
+// rules on a signal that no collector sets are refused.
+type Collector interface {
+	Collect(ctx context.Context, attempt *Attempt, signals Signals) error
+	Signals() []string
+}
+
+type CollectorFunc func(ctx context.Context, attempt *Attempt, signals Signals) error
+
+// NewCollector declares the signals that fn may set.
+func NewCollector(fn CollectorFunc, signals ...string) Collector {
+	return &collector{fn: fn, signals: signals}
+}
+
+type collector struct {
+	fn      CollectorFunc
+	signals []string
+}
+
+func (c *collector) Collect(ctx context.Context, attempt *Attempt, signals Signals) error {
+	return c.fn(ctx, attempt, signals)
+}
+
+func (c *collector) Signals() []string {
+	return c.signals
+}
+
+type Assessment struct {
+	Score    int      `json:"score"`
+	Decision Decision `json:"decision"`
+	Rules    []string `json:"rules"`
+	Signals  Signals  `json:"signals"`
+}
+
+type ruleSet struct {
+	config   *Config
+	location *time.Location
+}
+
+// Engine scores attempts with the signals of its collectors and the rules of
+// the current config, which can be replaced at runtime.
+type Engine struct {
+	rules      atomic.Pointer[ruleSet]
+	collectors []Collector
+}
+
+func NewEngine(config *Config, collectors ...Collector) (*Engine, error) {
+	e := &Engine{collectors: collectors}
+	if err := e.SetConfig(config); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetConfig validates and atomically swaps the rule set.
+func (e *Engine) SetConfig(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := config.checkSignals(e.signals()); err != nil {
+		return err
+	}
+
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return err
+	}
+
+	e.rules.Store(&ruleSet{config: config, location: location})
+	return nil
+}
+
+func (e *Engine) Config() *Config {
+	return e.rules.Load().config
+}
+
+// signals are the names set by the engine itself and by its collectors.
+func (e *Engine) signals() []string {
+	signals := []string{SignalRefresh, SignalHour}
+	for _, collector := range e.collectors {
+		signals = append(signals, collector.Signals()...)
+	}
+	return signals
+}
+
+// Use registers additional collectors, it must be called before the engine
+// is shared between goroutines.
+func (e *Engine) Use(collectors ...Collector) {
+	e.collectors = append(e.collectors, collectors...)
+}
+
+func (e *Engine) Assess(ctx context.Context, attempt *Attempt) (*Assessment, error) {
+	rules := e.rules.Load()
+
+	signals := Signals{}
+	signals.SetBool(SignalRefresh, attempt.Refresh)
+	signals[SignalHour] = float64(attempt.Time.In(rules.location).Hour())
+
+	for _, collector := range e.collectors {
+		if err := collector.Collect(ctx, attempt, signals); err != nil {
+			return nil, err
+		}
+	}
+
+	assessment := &Assessment{Decision: Allow, Rules: []string{}, Signals: signals}
+	for _, rule := range rules.config.Rules {
+		if rule.matches(signals) {
+			assessment.Score += rule.Score
+			assessment.Rules = append(assessment.Rules, rule.Name)
+		}
+	}
+
+	thresholds := rules.config.Thresholds
+	for _, level := range []struct {
+		threshold int
+		decision  Decision
+	}{
+		{thresholds.Notify, Notify},
+		{thresholds.Block, Block},
+	} {
+		if level.threshold > 0 && assessment.Score >= level.threshold {
+			assessment.Decision = level.decision
+		}
+	}
+
+	return assessment, nil
+}
+
+// WatchFile reloads the config from path whenever its modification time
+// changes, until ctx is cancelled. An invalid file is logged and the current
+// rules are kept.
+func (e *Engine) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+
+			config, err := LoadConfig(path)
+			if err == nil {
+				err = e.SetConfig(config)
+			}
+			if err != nil {
+				slog.Error("risk: keeping previous rules", "path", path, "error", err)
+				continue
+			}
+			slog.Info("risk: reloaded rules", "path", path, "rules", len(config.Rules))
+		}
+	}
+}
+
+func (r Rule) matches(signals Signals) bool {
+	for _, cond := range r.Conditions {
+		if !cond.matches(signals) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/lostxs/BackDev-test/internal/geoip"
+)
+
+const (
+	AuditActionSessionCreated      = "session.created"
+	AuditActionSessionRefreshed    = "session.refreshed"
+	AuditActionSessionLoggedOut    = "session.logged_out"
+	AuditActionIPChanged           = "ip.changed"
+	AuditActionTokenReuseDetected  = "token.reuse_detected"
+	AuditActionUserCreated         = "user.created"
+	AuditActionUserDisabled        = "user.disabled"
+	AuditActionUserEnabled         = "user.enabled"
+	AuditActionUserDeleted         = "user.deleted"
+	AuditActionUserImpersonated    = "user.impersonated"
+	AuditActionUserIPPolicySet     = "user.ip_policy_set"
+	AuditActionUserOrganizationSet = "user.organization_set"
+	AuditActionIPNotAllowed        = "ip.not_allowed"
+	AuditActionAllowlistAdded      = "ip_allowlist.added"
+	AuditActionAllowlistRemoved    = "ip_allowlist.removed"
+	AuditActionOrganizationCreated = "organization.created"
+	AuditActionOrganizationDeleted = "organization.deleted"
+	AuditActionRiskAssessed        = "risk.assessed"
+	AuditActionRiskBlocked         = "risk.blocked"
+	AuditActionOutboxReplayed      = "outbox.replayed"
+	AuditActionWebhookCreated      = "webhook.created"
+	AuditActionWebhookDeleted      = "webhook.deleted"
+)
+
+type AuditEvent struct {
+	ID        int64          `json:"id"`
+	Action    string         `json:"action"`
+	ActorID   string         `json:"actor_id,omitempty"`
+	SubjectID string         `json:"subject_id,omitempty"`
+	IPAddress string         `json:"ip_address"`
+	UserAgent string         `json:"user_agent"`
+	RequestID string         `json:"request_id"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	// Location is set when a GeoIP database is configured.
+	Location  *geoip.Location `json:"location,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter describes a page of audit events, newest first. Cursor is the ID
+// of the last event of the previous page.
+type AuditFilter struct {
+	ActorID   string
+	SubjectID string
+	Action    string
+	Cursor    int64
+	Limit     int
+}
+
+type AuditStore struct {
+	db *sql.DB
+}
+
+func (s *AuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	if event.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	location, err := marshalLocation(event.Location)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO audit_events (action, actor_id, subject_id, ip_address, user_agent, request_id, metadata, location)
+	VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		event.Action,
+		event.ActorID,
+		event.SubjectID,
+		event.IPAddress,
+		event.UserAgent,
+		event.RequestID,
+		metadata,
+		location,
+	).Scan(
+		&event.ID,
+		&event.CreatedAt,
+	)
+}
+
+// CountRecent counts the subject's events with one of the actions since the
+// given time.
+func (s *AuditStore) CountRecent(ctx context.Context, subjectID string, actions []string, since time.Time) (int, error) {
+	if _, err := uuid.Parse(subjectID); err != nil {
+		return 0, ErrInvalidUserID
+	}
+
+	query := `
+	SELECT COUNT(*)
+	FROM audit_events
+	WHERE subject_id = $1 AND action = ANY($2) AND created_at >= $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, subjectID, pq.Array(actions), since).Scan(&count)
+	return count, err
+}
+
+func (s *AuditStore) List(ctx context.Context, filter AuditFilter) ([]*AuditEvent, error) {
+	for _, id := range []string{filter.ActorID, filter.SubjectID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, ErrInvalidUserID
+		}
+	}
+
+	query := `
+	SELECT id, action, COALESCE(actor_id::text, ''), COALESCE(subject_id::text, ''),
+		ip_address, user_agent, request_id, metadata, location, created_at
+	FROM audit_events
+	WHERE ($1 = '' OR actor_id = NULLIF($1, '')::uuid)
+		AND ($2 = '' OR subject_id = NULLIF($2, '')::uuid)
+		AND ($3 = '' OR action = $3)
+		AND ($4 = 0 OR id < $4)
+	ORDER BY id DESC
+	LIMIT $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		filter.ActorID,
+		filter.SubjectID,
+		filter.Action,
+		filter.Cursor,
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		event := &AuditEvent{}
+		var metadata, location []byte
+		if err := rows.Scan(
+			&event.ID,
+			&event.Action,
+			&event.ActorID,
+			&event.SubjectID,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.RequestID,
+			&metadata,
+			&location,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+			return nil, err
+		}
+		if event.Location, err = unmarshalLocation(location); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
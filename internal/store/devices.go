@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Device is a client a user has successfully authenticated from, identified
+// by a fingerprint of its client-supplied identifiers.
+type Device struct {
+	UserID      string    `json:"user_id"`
+	Fingerprint string    `json:"fingerprint"`
+	UserAgent   string    `json:"user_agent"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+type DeviceStore struct {
+	db *sql.DB
+}
+
+func (s *DeviceStore) Exists(ctx context.Context, userID, fingerprint string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1 AND fingerprint = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, query, userID, fingerprint).Scan(&exists)
+	return exists, err
+}
+
+// Touch records the device or refreshes its last_seen_at.
+func (s *DeviceStore) Touch(ctx context.Context, device *Device) error {
+	query := `
+	INSERT INTO user_devices (user_id, fingerprint, user_agent)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, fingerprint) DO UPDATE SET user_agent = $3, last_seen_at = NOW()
+	RETURNING first_seen_at, last_seen_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		device.UserID,
+		device.Fingerprint,
+		device.UserAgent,
+	).Scan(
+		&device.FirstSeenAt,
+		&device.LastSeenAt,
+	)
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAllowlistEntryNotFound = errors.New("allowlist entry not found")
+)
+
+// IPAllowlistEntry belongs to either a user or an organization.
+type IPAllowlistEntry struct {
+	ID             int64     `json:"id"`
+	UserID         string    `json:"user_id,omitempty"`
+	OrganizationID string    `json:"organization_id,omitempty"`
+	CIDR           string    `json:"cidr"`
+	Description    string    `json:"description,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type IPAllowlistStore struct {
+	db *sql.DB
+}
+
+func (s *IPAllowlistStore) Create(ctx context.Context, entry *IPAllowlistEntry) error {
+	query := `
+	INSERT INTO ip_allowlist_entries (user_id, organization_id, cidr, description)
+	VALUES (NULLIF($1, '')::uuid, NULLIF($2, '')::uuid, $3, $4)
+	RETURNING id, cidr::text, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		entry.UserID,
+		entry.OrganizationID,
+		entry.CIDR,
+		entry.Description,
+	).Scan(
+		&entry.ID,
+		&entry.CIDR,
+		&entry.CreatedAt,
+	)
+}
+
+// List returns the entries of a user or an organization, ownerID is matched
+// against both.
+func (s *IPAllowlistStore) List(ctx context.Context, ownerID string) ([]*IPAllowlistEntry, error) {
+	query := `
+	SELECT id, COALESCE(user_id::text, ''), COALESCE(organization_id::text, ''), cidr::text, description, created_at
+	FROM ip_allowlist_entries
+	WHERE user_id = $1 OR organization_id = $1
+	ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*IPAllowlistEntry{}
+	for rows.Next() {
+		entry := &IPAllowlistEntry{}
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.OrganizationID,
+			&entry.CIDR,
+			&entry.Description,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *IPAllowlistStore) Delete(ctx context.Context, ownerID string, id int64) error {
+	query := `DELETE FROM ip_allowlist_entries WHERE id = $1 AND (user_id = $2 OR organization_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, ownerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAllowlistEntryNotFound
+	}
+
+	return nil
+}
@@ -3,38 +3,138 @@ package store
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type MockUserStore struct {
-	users map[string]*User
+	users    map[string]*User
+	sessions *MockSessionStore
+	roles    *MockRoleStore
 }
 
 type MockSessionStore struct {
 	sessions map[string]*Session
+	outbox   *MockOutboxStore
+}
+
+type MockOutboxStore struct {
+	Messages []*OutboxMessage
+}
+
+type MockAuditStore struct {
+	Events []*AuditEvent
+}
+
+type MockWebhookStore struct {
+	endpoints  []*WebhookEndpoint
+	Deliveries []*WebhookDelivery
+}
+
+type MockOrganizationStore struct {
+	organizations map[string]*Organization
+	users         *MockUserStore
+	allowlists    *MockIPAllowlistStore
+}
+
+type MockDeviceStore struct {
+	devices map[string]*Device
+}
+
+type MockIPAllowlistStore struct {
+	entries []*IPAllowlistEntry
+}
+
+type MockRoleStore struct {
+	roles     map[string]*Role
+	userRoles map[string][]*Role
 }
 
 func NewMockStore() Storage {
-	return Storage{
-		Users: &MockUserStore{
-			users: make(map[string]*User),
+	outbox := &MockOutboxStore{}
+	sessions := &MockSessionStore{
+		sessions: make(map[string]*Session),
+		outbox:   outbox,
+	}
+	roles := &MockRoleStore{
+		roles: map[string]*Role{
+			"admin": {ID: 1, Name: "admin", Permissions: []string{"sessions:revoke", "users:read", "users:write", "users:impersonate", "audit:read", "organizations:manage"}},
+			"user":  {ID: 2, Name: "user", Permissions: []string{}},
 		},
-		Sessions: &MockSessionStore{
-			sessions: make(map[string]*Session),
+		userRoles: make(map[string][]*Role),
+	}
+
+	users := &MockUserStore{
+		users:    make(map[string]*User),
+		sessions: sessions,
+		roles:    roles,
+	}
+	allowlists := &MockIPAllowlistStore{}
+
+	return Storage{
+		Users:    users,
+		Sessions: sessions,
+		Roles:    roles,
+		Audit:    &MockAuditStore{},
+		Outbox:   outbox,
+		Webhooks: &MockWebhookStore{},
+		Organizations: &MockOrganizationStore{
+			organizations: make(map[string]*Organization),
+			users:         users,
+			allowlists:    allowlists,
 		},
+		IPAllowlists: allowlists,
+		Devices:      &MockDeviceStore{devices: make(map[string]*Device)},
 	}
 }
 
 func (m *MockUserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
-	if _, exists := m.users[user.Email]; exists {
-		return ErrDuplicateEmail
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, user.Email) {
+			return ErrDuplicateEmail
+		}
+	}
+
+	if user.ID == "" {
+		user.ID = uuid.NewString()
+	}
+	if user.Locale == "" {
+		user.Locale = "en"
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
 	}
 
 	m.users[user.ID] = user
 	return nil
 }
 
+func (m *MockUserStore) CreateWithRoles(ctx context.Context, user *User, roles []string) error {
+	var unknown []string
+	for _, role := range roles {
+		if _, exists := m.roles.roles[role]; !exists {
+			unknown = append(unknown, role)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, strings.Join(unknown, ", "))
+	}
+
+	if err := m.Create(ctx, nil, user); err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		m.roles.AssignToUser(ctx, nil, user.ID, role)
+	}
+
+	return nil
+}
+
 func (m *MockUserStore) GetByID(ctx context.Context, id string) (*User, error) {
 	if user, exists := m.users[id]; exists {
 		return user, nil
@@ -47,8 +147,98 @@ func (m *MockUserStore) GetByID(ctx context.Context, id string) (*User, error) {
 	return nil, ErrUserNotFound
 }
 
+func (m *MockUserStore) List(ctx context.Context, filter UserFilter) ([]*User, error) {
+	users := []*User{}
+	for _, user := range m.users {
+		if filter.Cursor != "" && user.ID <= filter.Cursor {
+			continue
+		}
+		if filter.Search != "" && !strings.Contains(strings.ToLower(user.Email), strings.ToLower(filter.Search)) {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	slices.SortFunc(users, func(a, b *User) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+
+	return users, nil
+}
+
+func (m *MockUserStore) Disable(ctx context.Context, id string) error {
+	user, err := m.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if user.DisabledAt == nil {
+		now := time.Now()
+		user.DisabledAt = &now
+	}
+
+	delete(m.sessions.sessions, id)
+	return nil
+}
+
+func (m *MockUserStore) Enable(ctx context.Context, id string) error {
+	user, err := m.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.DisabledAt = nil
+	return nil
+}
+
+func (m *MockUserStore) SetIPChangePolicy(ctx context.Context, id string, policy string) error {
+	user, err := m.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.IPChangePolicy = policy
+	return nil
+}
+
+func (m *MockUserStore) SetOrganization(ctx context.Context, id string, organizationID string) error {
+	user, err := m.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.OrganizationID = organizationID
+	return nil
+}
+
+func (m *MockUserStore) Delete(ctx context.Context, id string) error {
+	if _, exists := m.users[id]; !exists {
+		return ErrUserNotFound
+	}
+
+	delete(m.users, id)
+	delete(m.sessions.sessions, id)
+	delete(m.roles.userRoles, id)
+	return nil
+}
+
 func (m *MockSessionStore) Upsert(ctx context.Context, session *Session) error {
-	m.sessions[session.ID] = session
+	return m.UpsertWithOutbox(ctx, session)
+}
+
+func (m *MockSessionStore) UpsertWithOutbox(ctx context.Context, session *Session, messages ...*OutboxMessage) error {
+	if session.ID == "" {
+		session.ID = uuid.NewString()
+	}
+	session.UpdatedAt = time.Now()
+	m.sessions[session.UserID] = session
+	for _, msg := range messages {
+		m.outbox.enqueue(msg)
+	}
 	return nil
 }
 
@@ -59,7 +249,354 @@ func (m *MockSessionStore) GetByUserID(ctx context.Context, userID string) (*Ses
 	return nil, ErrSessionNotFound
 }
 
+func (m *MockSessionStore) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, exists := m.sessions[userID]; !exists {
+		return ErrSessionNotFound
+	}
+
+	delete(m.sessions, userID)
+	return nil
+}
+
 func (m *MockSessionStore) Delete(ctx context.Context, id string) error {
-	delete(m.sessions, id)
+	for userID, session := range m.sessions {
+		if session.ID == id {
+			delete(m.sessions, userID)
+		}
+	}
+	return nil
+}
+
+func (m *MockRoleStore) GetByUserID(ctx context.Context, userID string) ([]*Role, error) {
+	return m.userRoles[userID], nil
+}
+
+func (m *MockRoleStore) AssignToUser(ctx context.Context, tx *sql.Tx, userID, roleName string) error {
+	role, exists := m.roles[roleName]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+
+	for _, r := range m.userRoles[userID] {
+		if r.Name == roleName {
+			return nil
+		}
+	}
+
+	m.userRoles[userID] = append(m.userRoles[userID], role)
+	return nil
+}
+
+func (m *MockAuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	event.ID = int64(len(m.Events) + 1)
+	event.CreatedAt = time.Now()
+	m.Events = append(m.Events, event)
+	return nil
+}
+
+func (m *MockAuditStore) CountRecent(ctx context.Context, subjectID string, actions []string, since time.Time) (int, error) {
+	count := 0
+	for _, event := range m.Events {
+		if event.SubjectID == subjectID && slices.Contains(actions, event.Action) && !event.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MockAuditStore) List(ctx context.Context, filter AuditFilter) ([]*AuditEvent, error) {
+	events := []*AuditEvent{}
+	for i := len(m.Events) - 1; i >= 0 && len(events) < filter.Limit; i-- {
+		event := m.Events[i]
+		if filter.ActorID != "" && event.ActorID != filter.ActorID {
+			continue
+		}
+		if filter.SubjectID != "" && event.SubjectID != filter.SubjectID {
+			continue
+		}
+		if filter.Action != "" && event.Action != filter.Action {
+			continue
+		}
+		if filter.Cursor != 0 && event.ID >= filter.Cursor {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (m *MockOutboxStore) enqueue(msg *OutboxMessage) {
+	for _, existing := range m.Messages {
+		if existing.IdempotencyKey == msg.IdempotencyKey {
+			return
+		}
+	}
+
+	msg.ID = int64(len(m.Messages) + 1)
+	msg.Status = OutboxStatusPending
+	msg.CreatedAt = time.Now()
+	msg.NextAttemptAt = msg.CreatedAt
+	m.Messages = append(m.Messages, msg)
+}
+
+func (m *MockOutboxStore) Create(ctx context.Context, messages ...*OutboxMessage) error {
+	for _, msg := range messages {
+		m.enqueue(msg)
+	}
+	return nil
+}
+
+func (m *MockOutboxStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	now := time.Now()
+
+	messages := []*OutboxMessage{}
+	for _, msg := range m.Messages {
+		if len(messages) == limit {
+			break
+		}
+		if msg.Status == OutboxStatusPending && !msg.NextAttemptAt.After(now) {
+			msg.NextAttemptAt = now.Add(lease)
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages, nil
+}
+
+func (m *MockOutboxStore) get(id int64, status string) (*OutboxMessage, error) {
+	for _, msg := range m.Messages {
+		if msg.ID == id && msg.Status == status {
+			return msg, nil
+		}
+	}
+	return nil, ErrOutboxMessageNotFound
+}
+
+func (m *MockOutboxStore) MarkSent(ctx context.Context, id int64) error {
+	msg, err := m.get(id, OutboxStatusPending)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	msg.Status = OutboxStatusSent
+	msg.SentAt = &now
+	msg.Attempts++
+	msg.LastError = ""
+	return nil
+}
+
+func (m *MockOutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	msg, err := m.get(id, OutboxStatusPending)
+	if err != nil {
+		return err
+	}
+
+	msg.Attempts++
+	msg.LastError = lastError
+	if nextAttemptAt == nil {
+		msg.Status = OutboxStatusDead
+	} else {
+		msg.NextAttemptAt = *nextAttemptAt
+	}
+	return nil
+}
+
+func (m *MockOutboxStore) List(ctx context.Context, filter OutboxFilter) ([]*OutboxMessage, error) {
+	messages := []*OutboxMessage{}
+	for i := len(m.Messages) - 1; i >= 0 && len(messages) < filter.Limit; i-- {
+		msg := m.Messages[i]
+		if filter.Status != "" && msg.Status != filter.Status {
+			continue
+		}
+		if filter.Cursor != 0 && msg.ID >= filter.Cursor {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (m *MockOutboxStore) Replay(ctx context.Context, id int64) error {
+	msg, err := m.get(id, OutboxStatusDead)
+	if err != nil {
+		return err
+	}
+
+	msg.Status = OutboxStatusPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = time.Now()
+	msg.LastError = ""
+	return nil
+}
+
+func (m *MockOutboxStore) Backlog(ctx context.Context) (*OutboxBacklog, error) {
+	backlog := &OutboxBacklog{}
+	for _, msg := range m.Messages {
+		if msg.Status != OutboxStatusPending {
+			continue
+		}
+		backlog.Pending++
+		if backlog.Oldest == nil || msg.CreatedAt.Before(*backlog.Oldest) {
+			createdAt := msg.CreatedAt
+			backlog.Oldest = &createdAt
+		}
+	}
+	return backlog, nil
+}
+
+func (m *MockWebhookStore) Create(ctx context.Context, endpoint *WebhookEndpoint) error {
+	endpoint.ID = uuid.NewString()
+	endpoint.Active = true
+	endpoint.CreatedAt = time.Now()
+	m.endpoints = append(m.endpoints, endpoint)
+	return nil
+}
+
+func (m *MockWebhookStore) GetByID(ctx context.Context, id string) (*WebhookEndpoint, error) {
+	for _, endpoint := range m.endpoints {
+		if endpoint.ID == id {
+			return endpoint, nil
+		}
+	}
+	return nil, ErrWebhookNotFound
+}
+
+func (m *MockWebhookStore) List(ctx context.Context) ([]*WebhookEndpoint, error) {
+	return append([]*WebhookEndpoint{}, m.endpoints...), nil
+}
+
+func (m *MockWebhookStore) ListSubscribed(ctx context.Context, eventType string) ([]*WebhookEndpoint, error) {
+	endpoints := []*WebhookEndpoint{}
+	for _, endpoint := range m.endpoints {
+		if endpoint.Active && slices.Contains(endpoint.EventTypes, eventType) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints, nil
+}
+
+func (m *MockWebhookStore) Delete(ctx context.Context, id string) error {
+	for i, endpoint := range m.endpoints {
+		if endpoint.ID == id {
+			m.endpoints = slices.Delete(m.endpoints, i, i+1)
+			return nil
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+func (m *MockWebhookStore) LogDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	delivery.ID = int64(len(m.Deliveries) + 1)
+	delivery.CreatedAt = time.Now()
+	m.Deliveries = append(m.Deliveries, delivery)
+	return nil
+}
+
+func (m *MockWebhookStore) ListDeliveries(ctx context.Context, endpointID string, cursor int64, limit int) ([]*WebhookDelivery, error) {
+	deliveries := []*WebhookDelivery{}
+	for i := len(m.Deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		delivery := m.Deliveries[i]
+		if delivery.EndpointID != endpointID || (cursor != 0 && delivery.ID >= cursor) {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (m *MockOrganizationStore) Create(ctx context.Context, org *Organization) error {
+	for _, o := range m.organizations {
+		if o.Name == org.Name {
+			return ErrDuplicateOrganization
+		}
+	}
+
+	org.ID = uuid.NewString()
+	org.CreatedAt = time.Now()
+	m.organizations[org.ID] = org
+	return nil
+}
+
+func (m *MockOrganizationStore) GetByID(ctx context.Context, id string) (*Organization, error) {
+	if org, exists := m.organizations[id]; exists {
+		return org, nil
+	}
+	return nil, ErrOrganizationNotFound
+}
+
+func (m *MockOrganizationStore) List(ctx context.Context) ([]*Organization, error) {
+	orgs := []*Organization{}
+	for _, org := range m.organizations {
+		orgs = append(orgs, org)
+	}
+
+	slices.SortFunc(orgs, func(a, b *Organization) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return orgs, nil
+}
+
+func (m *MockOrganizationStore) Delete(ctx context.Context, id string) error {
+	if _, exists := m.organizations[id]; !exists {
+		return ErrOrganizationNotFound
+	}
+
+	delete(m.organizations, id)
+	for _, user := range m.users.users {
+		if user.OrganizationID == id {
+			user.OrganizationID = ""
+		}
+	}
+	m.allowlists.entries = slices.DeleteFunc(m.allowlists.entries, func(entry *IPAllowlistEntry) bool {
+		return entry.OrganizationID == id
+	})
+	return nil
+}
+
+func (m *MockIPAllowlistStore) Create(ctx context.Context, entry *IPAllowlistEntry) error {
+	entry.ID = int64(len(m.entries) + 1)
+	entry.CreatedAt = time.Now()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *MockIPAllowlistStore) List(ctx context.Context, ownerID string) ([]*IPAllowlistEntry, error) {
+	entries := []*IPAllowlistEntry{}
+	for _, entry := range m.entries {
+		if entry.UserID == ownerID || entry.OrganizationID == ownerID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MockIPAllowlistStore) Delete(ctx context.Context, ownerID string, id int64) error {
+	for i, entry := range m.entries {
+		if entry.ID == id && (entry.UserID == ownerID || entry.OrganizationID == ownerID) {
+			m.entries = slices.Delete(m.entries, i, i+1)
+			return nil
+		}
+	}
+	return ErrAllowlistEntryNotFound
+}
+
+func (m *MockDeviceStore) Exists(ctx context.Context, userID, fingerprint string) (bool, error) {
+	_, exists := m.devices[userID+"/"+fingerprint]
+	return exists, nil
+}
+
+func (m *MockDeviceStore) Touch(ctx context.Context, device *Device) error {
+	now := time.Now()
+	if existing, exists := m.devices[device.UserID+"/"+device.Fingerprint]; exists {
+		device.FirstSeenAt = existing.FirstSeenAt
+	} else {
+		device.FirstSeenAt = now
+	}
+	device.LastSeenAt = now
+	m.devices[device.UserID+"/"+device.Fingerprint] = device
 	return nil
 }
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDuplicateOrganization = errors.New("an organization with that name already exists")
+	ErrOrganizationNotFound  = errors.New("organization not found")
+)
+
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrganizationStore struct {
+	db *sql.DB
+}
+
+func (s *OrganizationStore) Create(ctx context.Context, org *Organization) error {
+	query := `
+	INSERT INTO organizations (name)
+	VALUES ($1)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, org.Name).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_name_key"`:
+			return ErrDuplicateOrganization
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *OrganizationStore) GetByID(ctx context.Context, id string) (*Organization, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	query := `
+	SELECT id, name, created_at
+	FROM organizations
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	org := &Organization{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrOrganizationNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return org, nil
+}
+
+func (s *OrganizationStore) List(ctx context.Context) ([]*Organization, error) {
+	query := `
+	SELECT id, name, created_at
+	FROM organizations
+	ORDER BY name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		org := &Organization{}
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Delete removes the organization and its allowlist, members are kept
+// without an organization.
+func (s *OrganizationStore) Delete(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrOrganizationNotFound
+	}
+
+	query := `DELETE FROM organizations WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	return nil
+}
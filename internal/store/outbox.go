@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	OutboxKindEmail   = "email"
+	OutboxKindWebhook = "webhook"
+
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+var (
+	ErrOutboxMessageNotFound = errors.New("outbox message not found")
+)
+
+type OutboxMessage struct {
+	ID             int64           `json:"id"`
+	IdempotencyKey string          `json:"idempotency_key"`
+	Kind           string          `json:"kind"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	SentAt         *time.Time      `json:"sent_at,omitempty"`
+}
+
+// OutboxBacklog summarizes the messages waiting for delivery.
+type OutboxBacklog struct {
+	Pending int `json:"pending"`
+	// Oldest is when the oldest pending message was created, nil when
+	// nothing is pending.
+	Oldest *time.Time `json:"oldest,omitempty"`
+}
+
+// OutboxFilter describes a page of outbox messages, newest first. Cursor is
+// the ID of the last message of the previous page.
+type OutboxFilter struct {
+	Status string
+	Cursor int64
+	Limit  int
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// Enqueue stores msg in tx, a message with an already known idempotency key
+// is silently dropped.
+func (s *OutboxStore) Enqueue(ctx context.Context, tx *sql.Tx, msg *OutboxMessage) error {
+	query := `
+	INSERT INTO outbox (idempotency_key, kind, payload)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, msg.IdempotencyKey, msg.Kind, []byte(msg.Payload))
+	return err
+}
+
+// Create enqueues messages outside of any other change.
+func (s *OutboxStore) Create(ctx context.Context, messages ...*OutboxMessage) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		for _, msg := range messages {
+			if err := s.Enqueue(ctx, tx, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimDue returns up to limit pending messages that are due and hides them
+// from other workers for the lease duration.
+func (s *OutboxStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	query := `
+	UPDATE outbox SET next_attempt_at = NOW() + make_interval(secs => $2)
+	WHERE id IN (
+		SELECT id FROM outbox
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + outboxColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	query := `
+	UPDATE outbox SET status = 'sent', sent_at = NOW(), attempts = attempts + 1, last_error = ''
+	WHERE id = $1 AND status = 'pending'
+	`
+
+	return s.exec(ctx, query, id)
+}
+
+// MarkFailed records a failed delivery attempt. A nil nextAttemptAt moves the
+// message to the dead-letter state.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+	UPDATE outbox SET
+		attempts = attempts + 1,
+		last_error = $2,
+		status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+		next_attempt_at = COALESCE($3, next_attempt_at)
+	WHERE id = $1 AND status = 'pending'
+	`
+
+	return s.exec(ctx, query, id, lastError, nextAttemptAt)
+}
+
+func (s *OutboxStore) List(ctx context.Context, filter OutboxFilter) ([]*OutboxMessage, error) {
+	query := `
+	SELECT ` + outboxColumns + `
+	FROM outbox
+	WHERE ($1 = '' OR status = $1)
+		AND ($2 = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, filter.Status, filter.Cursor, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+// Replay schedules a dead message for immediate redelivery.
+func (s *OutboxStore) Replay(ctx context.Context, id int64) error {
+	query := `
+	UPDATE outbox SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = ''
+	WHERE id = $1 AND status = 'dead'
+	`
+
+	return s.exec(ctx, query, id)
+}
+
+func (s *OutboxStore) Backlog(ctx context.Context) (*OutboxBacklog, error) {
+	query := `
+	SELECT COUNT(*), MIN(created_at)
+	FROM outbox
+	WHERE status = 'pending'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	backlog := &OutboxBacklog{}
+	if err := s.db.QueryRowContext(ctx, query).Scan(&backlog.Pending, &backlog.Oldest); err != nil {
+		return nil, err
+	}
+
+	return backlog, nil
+}
+
+func (s *OutboxStore) exec(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	return nil
+}
+
+const outboxColumns = `id, idempotency_key, kind, payload, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+
+func scanOutboxMessages(rows *sql.Rows) ([]*OutboxMessage, error) {
+	messages := []*OutboxMessage{}
+	for rows.Next() {
+		msg := &OutboxMessage{}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.IdempotencyKey,
+			&msg.Kind,
+			&msg.Payload,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.NextAttemptAt,
+			&msg.LastError,
+			&msg.CreatedAt,
+			&msg.SentAt,
+		); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RateLimitStore keeps the token buckets of the rate limiter, so replicas
+// share them. Refills use the database clock.
+type RateLimitStore struct {
+	db *sql.DB
+}
+
+func NewRateLimitStore(db *sql.DB) *RateLimitStore {
+	return &RateLimitStore{db}
+}
+
+// Take refills the bucket of key and takes a token if one is left. The
+// upsert locks the row until the transaction ends, so concurrent requests
+// cannot take the same token.
+func (s *RateLimitStore) Take(ctx context.Context, key string, capacity, rate float64) (float64, bool, error) {
+	// NOW() is when the transaction started, which can be before a racing
+	// transaction on the same key committed. clock_timestamp() is read after
+	// the row lock is taken, and elapsed time is clamped should clocks step.
+	refill := `
+	INSERT INTO rate_limits AS rl (key, tokens, updated_at)
+	VALUES ($1, $2, clock_timestamp())
+	ON CONFLICT (key) DO UPDATE SET
+		tokens = LEAST($2, rl.tokens + GREATEST(0, EXTRACT(EPOCH FROM clock_timestamp() - rl.updated_at)) * $3),
+		updated_at = GREATEST(rl.updated_at, clock_timestamp())
+	RETURNING tokens
+	`
+	take := `UPDATE rate_limits SET tokens = tokens - 1 WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var tokens float64
+	var allowed bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, refill, key, capacity, rate).Scan(&tokens); err != nil {
+			return err
+		}
+		if tokens < 1 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, take, key); err != nil {
+			return err
+		}
+		tokens--
+		allowed = true
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return tokens, allowed, nil
+}
+
+func (s *RateLimitStore) Prune(ctx context.Context, maxIdle time.Duration) error {
+	query := `DELETE FROM rate_limits WHERE updated_at < NOW() - $1 * INTERVAL '1 second'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, maxIdle.Seconds())
+	return err
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+type Role struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleStore struct {
+	db *sql.DB
+}
+
+func (s *RoleStore) GetByUserID(ctx context.Context, userID string) ([]*Role, error) {
+	idUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	query := `
+	SELECT r.id, r.name, COALESCE(array_agg(p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+	FROM roles r
+	JOIN user_roles ur ON ur.role_id = r.id
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id
+	LEFT JOIN permissions p ON p.id = rp.permission_id
+	WHERE ur.user_id = $1
+	GROUP BY r.id, r.name
+	ORDER BY r.name
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, idUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		role := &Role{}
+		if err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			pq.Array(&role.Permissions),
+		); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// AssignToUser returns ErrRoleNotFound for a role that does not exist.
+func (s *RoleStore) AssignToUser(ctx context.Context, tx *sql.Tx, userID, roleName string) error {
+	query := `
+	WITH role AS (
+		SELECT id FROM roles WHERE name = $2
+	), assigned AS (
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM role
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM role)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, query, userID, roleName).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, roleName)
+	}
+	return nil
+}
+
+// checkRoles returns ErrRoleNotFound naming every role that does not exist.
+func checkRoles(ctx context.Context, tx *sql.Tx, names []string) error {
+	query := `
+	SELECT requested.name FROM unnest($1::text[]) AS requested(name)
+	WHERE NOT EXISTS (SELECT 1 FROM roles WHERE roles.name = requested.name)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var unknown []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		unknown = append(unknown, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Permissions returns the deduplicated union of permissions granted by roles.
+func Permissions(roles []*Role) []string {
+	seen := make(map[string]struct{})
+	permissions := []string{}
+
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			permissions = append(permissions, p)
+		}
+	}
+
+	return permissions
+}
@@ -3,13 +3,21 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/geoip"
 )
 
 type Session struct {
 	ID               string `json:"id"`
 	UserID           string `json:"user_id"`
 	RefreshTokenHash string `json:"refresh_token_hash"`
+	IPAddress        string `json:"ip_address"`
+	// Location is where the session was last created or refreshed from.
+	Location  *geoip.Location `json:"location,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
 }
 
 type SessionStore struct {
@@ -21,31 +29,54 @@ var (
 )
 
 func (s *SessionStore) Upsert(ctx context.Context, session *Session) error {
+	return s.UpsertWithOutbox(ctx, session)
+}
+
+// UpsertWithOutbox stores the session and enqueues the notifications in one
+// transaction, so a notification exists if and only if the session changed.
+func (s *SessionStore) UpsertWithOutbox(ctx context.Context, session *Session, messages ...*OutboxMessage) error {
 	query := `
-	INSERT INTO sessions (user_id, refresh_token_hash) 
-	VALUES ($1, $2) 
-	ON CONFLICT (user_id) DO UPDATE SET refresh_token_hash = $2
+	INSERT INTO sessions (user_id, refresh_token_hash, location, ip_address) 
+	VALUES ($1, $2, $3, $4) 
+	ON CONFLICT (user_id) DO UPDATE SET refresh_token_hash = $2, location = $3, ip_address = $4, updated_at = NOW()
+	RETURNING id, updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	_, err := s.db.ExecContext(
-		ctx,
-		query,
-		session.UserID,
-		session.RefreshTokenHash,
-	)
+	location, err := marshalLocation(session.Location)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			session.UserID,
+			session.RefreshTokenHash,
+			location,
+			session.IPAddress,
+		).Scan(&session.ID, &session.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		outbox := &OutboxStore{s.db}
+		for _, msg := range messages {
+			if err := outbox.Enqueue(ctx, tx, msg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func (s *SessionStore) GetByUserID(ctx context.Context, userID string) (*Session, error) {
 	query := `
-	SELECT id, user_id, refresh_token_hash 
+	SELECT id, user_id, refresh_token_hash, ip_address, location, updated_at
 	FROM sessions 
 	WHERE user_id = $1
 	`
@@ -54,11 +85,15 @@ func (s *SessionStore) GetByUserID(ctx context.Context, userID string) (*Session
 	defer cancel()
 
 	var session Session
+	var location []byte
 	row := s.db.QueryRowContext(ctx, query, userID)
 	err := row.Scan(
 		&session.ID,
 		&session.UserID,
 		&session.RefreshTokenHash,
+		&session.IPAddress,
+		&location,
+		&session.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -67,5 +102,51 @@ func (s *SessionStore) GetByUserID(ctx context.Context, userID string) (*Session
 		return nil, err
 	}
 
+	if session.Location, err = unmarshalLocation(location); err != nil {
+		return nil, err
+	}
+
 	return &session, nil
 }
+
+func (s *SessionStore) DeleteByUserID(ctx context.Context, userID string) error {
+	query := `DELETE FROM sessions WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// marshalLocation keeps unknown locations as SQL NULL rather than JSON null.
+func marshalLocation(location *geoip.Location) ([]byte, error) {
+	if location == nil {
+		return nil, nil
+	}
+	return json.Marshal(location)
+}
+
+func unmarshalLocation(data []byte) (*geoip.Location, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	location := &geoip.Location{}
+	if err := json.Unmarshal(data, location); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
@@ -13,17 +13,89 @@ var (
 type Storage struct {
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
+		CreateWithRoles(context.Context, *User, []string) error
 		GetByID(context.Context, string) (*User, error)
+		List(context.Context, UserFilter) ([]*User, error)
+		Disable(context.Context, string) error
+		Enable(context.Context, string) error
+		SetIPChangePolicy(context.Context, string, string) error
+		SetOrganization(context.Context, string, string) error
+		Delete(context.Context, string) error
 	}
 	Sessions interface {
 		Upsert(context.Context, *Session) error
+		UpsertWithOutbox(context.Context, *Session, ...*OutboxMessage) error
 		GetByUserID(context.Context, string) (*Session, error)
+		DeleteByUserID(context.Context, string) error
+	}
+	Roles interface {
+		GetByUserID(context.Context, string) ([]*Role, error)
+		AssignToUser(context.Context, *sql.Tx, string, string) error
+	}
+	Audit interface {
+		Create(context.Context, *AuditEvent) error
+		CountRecent(context.Context, string, []string, time.Time) (int, error)
+		List(context.Context, AuditFilter) ([]*AuditEvent, error)
+	}
+	Outbox interface {
+		Create(context.Context, ...*OutboxMessage) error
+		ClaimDue(context.Context, int, time.Duration) ([]*OutboxMessage, error)
+		MarkSent(context.Context, int64) error
+		MarkFailed(context.Context, int64, string, *time.Time) error
+		List(context.Context, OutboxFilter) ([]*OutboxMessage, error)
+		Replay(context.Context, int64) error
+		Backlog(context.Context) (*OutboxBacklog, error)
+	}
+	Webhooks interface {
+		Create(context.Context, *WebhookEndpoint) error
+		GetByID(context.Context, string) (*WebhookEndpoint, error)
+		List(context.Context) ([]*WebhookEndpoint, error)
+		ListSubscribed(context.Context, string) ([]*WebhookEndpoint, error)
+		Delete(context.Context, string) error
+		LogDelivery(context.Context, *WebhookDelivery) error
+		ListDeliveries(context.Context, string, int64, int) ([]*WebhookDelivery, error)
+	}
+	Organizations interface {
+		Create(context.Context, *Organization) error
+		GetByID(context.Context, string) (*Organization, error)
+		List(context.Context) ([]*Organization, error)
+		Delete(context.Context, string) error
+	}
+	Devices interface {
+		Exists(context.Context, string, string) (bool, error)
+		Touch(context.Context, *Device) error
+	}
+	IPAllowlists interface {
+		Create(context.Context, *IPAllowlistEntry) error
+		List(context.Context, string) ([]*IPAllowlistEntry, error)
+		Delete(context.Context, string, int64) error
 	}
 }
 
 func NewPostgresStorage(db *sql.DB) Storage {
 	return Storage{
-		Users:    &UserStore{db},
-		Sessions: &SessionStore{db},
+		Users:         tracedUserStore{&UserStore{db}},
+		Sessions:      tracedSessionStore{&SessionStore{db}},
+		Roles:         &RoleStore{db},
+		Audit:         &AuditStore{db},
+		Outbox:        &OutboxStore{db},
+		Webhooks:      &WebhookStore{db},
+		Organizations: &OrganizationStore{db},
+		IPAllowlists:  &IPAllowlistStore{db},
+		Devices:       &DeviceStore{db},
 	}
 }
+
+func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lostxs/BackDev-test/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/lostxs/BackDev-test/internal/store")
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql")),
+	)
+}
+
+// tracedUserStore adds a span to every query of UserStore.
+type tracedUserStore struct {
+	*UserStore
+}
+
+func (s tracedUserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
+	ctx, span := startSpan(ctx, "UserStore.Create")
+	err := s.UserStore.Create(ctx, tx, user)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedUserStore) CreateWithRoles(ctx context.Context, user *User, roles []string) error {
+	ctx, span := startSpan(ctx, "UserStore.CreateWithRoles")
+	err := s.UserStore.CreateWithRoles(ctx, user, roles)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedUserStore) GetByID(ctx context.Context, id string) (*User, error) {
+	ctx, span := startSpan(ctx, "UserStore.GetByID")
+	user, err := s.UserStore.GetByID(ctx, id)
+	tracing.End(span, err)
+	return user, err
+}
+
+func (s tracedUserStore) List(ctx context.Context, filter UserFilter) ([]*User, error) {
+	ctx, span := startSpan(ctx, "UserStore.List")
+	users, err := s.UserStore.List(ctx, filter)
+	tracing.End(span, err)
+	return users, err
+}
+
+func (s tracedUserStore) Disable(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "UserStore.Disable")
+	err := s.UserStore.Disable(ctx, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedUserStore) Enable(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "UserStore.Enable")
+	err := s.UserStore.Enable(ctx, id)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedUserStore) SetIPChangePolicy(ctx context.Context, id string, policy string) error {
+	ctx, span := startSpan(ctx, "UserStore.SetIPChangePolicy")
+	err := s.UserStore.SetIPChangePolicy(ctx, id, policy)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedUserStore) SetOrganization(ctx context.Context, id string, organizationID string) error {
+	ctx, span := startSpan(ctx, "UserStore.SetOrganization")
+	err := s.UserStore.SetOrganization(ctx, id, organizationID)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedUserStore) Delete(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "UserStore.Delete")
+	err := s.UserStore.Delete(ctx, id)
+	tracing.End(span, err)
+	return err
+}
+
+// tracedSessionStore adds a span to every query of SessionStore.
+type tracedSessionStore struct {
+	*SessionStore
+}
+
+func (s tracedSessionStore) Upsert(ctx context.Context, session *Session) error {
+	return s.UpsertWithOutbox(ctx, session)
+}
+
+func (s tracedSessionStore) UpsertWithOutbox(ctx context.Context, session *Session, messages ...*OutboxMessage) error {
+	ctx, span := startSpan(ctx, "SessionStore.UpsertWithOutbox")
+	span.SetAttributes(attribute.Int("outbox.messages", len(messages)))
+	err := s.SessionStore.UpsertWithOutbox(ctx, session, messages...)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedSessionStore) GetByUserID(ctx context.Context, userID string) (*Session, error) {
+	ctx, span := startSpan(ctx, "SessionStore.GetByUserID")
+	session, err := s.SessionStore.GetByUserID(ctx, userID)
+	tracing.End(span, err)
+	return session, err
+}
+
+func (s tracedSessionStore) DeleteByUserID(ctx context.Context, userID string) error {
+	ctx, span := startSpan(ctx, "SessionStore.DeleteByUserID")
+	err := s.SessionStore.DeleteByUserID(ctx, userID)
+	tracing.End(span, err)
+	return err
+}
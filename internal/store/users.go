@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
@@ -15,8 +18,26 @@ var (
 )
 
 type User struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
+	ID     string `json:"id"`
+	Email  string `json:"email"`
+	Locale string `json:"locale"`
+	// IPChangePolicy overrides the global policy when not empty.
+	IPChangePolicy string     `json:"ip_change_policy,omitempty"`
+	OrganizationID string     `json:"organization_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+}
+
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// UserFilter describes a page of users. Cursor is the ID of the last user of
+// the previous page, users are ordered by ID.
+type UserFilter struct {
+	Cursor string
+	Limit  int
+	Search string
 }
 
 type UserStore struct {
@@ -25,9 +46,9 @@ type UserStore struct {
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
-	INSERT INTO users (email) 
-	VALUES ($1) 
-	RETURNING id, email
+	INSERT INTO users (email, locale)
+	VALUES ($1, COALESCE(NULLIF($2, ''), 'en'))
+	RETURNING id, email, locale, created_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -37,9 +58,12 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		ctx,
 		query,
 		user.Email,
+		user.Locale,
 	).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Locale,
+		&user.CreatedAt,
 	)
 	if err != nil {
 		switch {
@@ -53,6 +77,27 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	return nil
 }
 
+func (s *UserStore) CreateWithRoles(ctx context.Context, user *User, roles []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := checkRoles(ctx, tx, roles); err != nil {
+			return err
+		}
+
+		if err := s.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		roleStore := &RoleStore{s.db}
+		for _, role := range roles {
+			if err := roleStore.AssignToUser(ctx, tx, user.ID, role); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 func (s *UserStore) GetByID(ctx context.Context, id string) (*User, error) {
 	idUUID, err := uuid.Parse(id)
 	if err != nil {
@@ -60,9 +105,9 @@ func (s *UserStore) GetByID(ctx context.Context, id string) (*User, error) {
 	}
 
 	query := `
-	SELECT id, email 
-	FROM users 
-	WHERE id = $1 
+	SELECT id, email, locale, COALESCE(ip_change_policy, ''), COALESCE(organization_id::text, ''), created_at, disabled_at
+	FROM users
+	WHERE id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -76,6 +121,11 @@ func (s *UserStore) GetByID(ctx context.Context, id string) (*User, error) {
 	).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Locale,
+		&user.IPChangePolicy,
+		&user.OrganizationID,
+		&user.CreatedAt,
+		&user.DisabledAt,
 	)
 	if err != nil {
 		switch err {
@@ -88,3 +138,192 @@ func (s *UserStore) GetByID(ctx context.Context, id string) (*User, error) {
 
 	return user, nil
 }
+
+func (s *UserStore) List(ctx context.Context, filter UserFilter) ([]*User, error) {
+	var cursor *uuid.UUID
+	if filter.Cursor != "" {
+		id, err := uuid.Parse(filter.Cursor)
+		if err != nil {
+			return nil, ErrInvalidUserID
+		}
+		cursor = &id
+	}
+
+	query := `
+	SELECT id, email, locale, COALESCE(ip_change_policy, ''), COALESCE(organization_id::text, ''), created_at, disabled_at
+	FROM users
+	WHERE ($1::uuid IS NULL OR id > $1)
+		AND ($2 = '' OR email ILIKE '%' || $2 || '%' ESCAPE '\')
+	ORDER BY id
+	LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, cursor, escapeLike(filter.Search), filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.Locale,
+			&user.IPChangePolicy,
+			&user.OrganizationID,
+			&user.CreatedAt,
+			&user.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// likeEscaper makes a search term match literally inside a LIKE pattern
+// using ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Disable marks the user as disabled and revokes all of their sessions in the
+// same transaction, so no refresh can succeed after it returns.
+func (s *UserStore) Disable(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidUserID
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET disabled_at = NOW() WHERE id = $1 AND disabled_at IS NULL`, id)
+		if err != nil {
+			return err
+		}
+
+		// Nothing was updated, either the user does not exist or is already
+		// disabled, which only revokes sessions again.
+		if rows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			var exists int
+			err := tx.QueryRowContext(ctx, `SELECT 1 FROM users WHERE id = $1`, id).Scan(&exists)
+			switch err {
+			case nil:
+			case sql.ErrNoRows:
+				return ErrUserNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, id)
+		return err
+	})
+}
+
+func (s *UserStore) Enable(ctx context.Context, id string) error {
+	query := `UPDATE users SET disabled_at = NULL WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetIPChangePolicy stores the user's policy, an empty policy falls back to
+// the global one.
+func (s *UserStore) SetIPChangePolicy(ctx context.Context, id string, policy string) error {
+	query := `UPDATE users SET ip_change_policy = NULLIF($2, '') WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, policy)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetOrganization moves the user into an organization, an empty id removes
+// them from it.
+func (s *UserStore) SetOrganization(ctx context.Context, id string, organizationID string) error {
+	query := `UPDATE users SET organization_id = NULLIF($2, '')::uuid WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, organizationID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrOrganizationNotFound
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
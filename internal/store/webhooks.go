@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+type WebhookEndpoint struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is a single delivery attempt of an event to an endpoint.
+type WebhookDelivery struct {
+	ID             int64     `json:"id"`
+	EndpointID     string    `json:"endpoint_id"`
+	OutboxID       int64     `json:"outbox_id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	ResponseStatus int       `json:"response_status"`
+	Error          string    `json:"error,omitempty"`
+	DurationMS     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+func (s *WebhookStore) Create(ctx context.Context, endpoint *WebhookEndpoint) error {
+	query := `
+	INSERT INTO webhook_endpoints (url, secret, event_types)
+	VALUES ($1, $2, $3)
+	RETURNING id, active, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		endpoint.URL,
+		endpoint.Secret,
+		pq.Array(endpoint.EventTypes),
+	).Scan(
+		&endpoint.ID,
+		&endpoint.Active,
+		&endpoint.CreatedAt,
+	)
+}
+
+func (s *WebhookStore) GetByID(ctx context.Context, id string) (*WebhookEndpoint, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	query := `
+	SELECT id, url, secret, event_types, active, created_at
+	FROM webhook_endpoints
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	endpoint := &WebhookEndpoint{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&endpoint.ID,
+		&endpoint.URL,
+		&endpoint.Secret,
+		pq.Array(&endpoint.EventTypes),
+		&endpoint.Active,
+		&endpoint.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrWebhookNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return endpoint, nil
+}
+
+func (s *WebhookStore) List(ctx context.Context) ([]*WebhookEndpoint, error) {
+	query := `
+	SELECT id, url, secret, event_types, active, created_at
+	FROM webhook_endpoints
+	ORDER BY created_at
+	`
+
+	return s.list(ctx, query)
+}
+
+// ListSubscribed returns the active endpoints subscribed to eventType.
+func (s *WebhookStore) ListSubscribed(ctx context.Context, eventType string) ([]*WebhookEndpoint, error) {
+	query := `
+	SELECT id, url, secret, event_types, active, created_at
+	FROM webhook_endpoints
+	WHERE active AND $1 = ANY(event_types)
+	`
+
+	return s.list(ctx, query, eventType)
+}
+
+func (s *WebhookStore) Delete(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrWebhookNotFound
+	}
+
+	query := `DELETE FROM webhook_endpoints WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (s *WebhookStore) LogDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	query := `
+	INSERT INTO webhook_deliveries (endpoint_id, outbox_id, event_id, event_type, response_status, error, duration_ms)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		delivery.EndpointID,
+		delivery.OutboxID,
+		delivery.EventID,
+		delivery.EventType,
+		delivery.ResponseStatus,
+		delivery.Error,
+		delivery.DurationMS,
+	).Scan(
+		&delivery.ID,
+		&delivery.CreatedAt,
+	)
+}
+
+// ListDeliveries returns the delivery log of an endpoint, newest first.
+// Cursor is the ID of the last delivery of the previous page.
+func (s *WebhookStore) ListDeliveries(ctx context.Context, endpointID string, cursor int64, limit int) ([]*WebhookDelivery, error) {
+	query := `
+	SELECT id, endpoint_id, outbox_id, event_id, event_type, response_status, error, duration_ms, created_at
+	FROM webhook_deliveries
+	WHERE endpoint_id = $1 AND ($2 = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, endpointID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.EndpointID,
+			&delivery.OutboxID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&delivery.ResponseStatus,
+			&delivery.Error,
+			&delivery.DurationMS,
+			&delivery.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *WebhookStore) list(ctx context.Context, query string, args ...any) ([]*WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []*WebhookEndpoint{}
+	for rows.Next() {
+		endpoint := &WebhookEndpoint{}
+		if err := rows.Scan(
+			&endpoint.ID,
+			&endpoint.URL,
+			&endpoint.Secret,
+			pq.Array(&endpoint.EventTypes),
+			&endpoint.Active,
+			&endpoint.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
@@ -0,0 +1,213 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cipher policies for TLS 1.2, TLS 1.3 suites are not configurable.
+const (
+	// PolicyIntermediate allows ECDHE key exchange with AEAD ciphers only,
+	// following the Mozilla intermediate profile.
+	PolicyIntermediate = "intermediate"
+	// PolicyCompatible also allows CBC ciphers for older clients.
+	PolicyCompatible = "compatible"
+)
+
+// Client authentication modes, they apply when a client CA is configured.
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+var intermediateSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Config enables TLS when CertFile is set.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is how often the certificate files are checked for
+	// changes.
+	ReloadInterval time.Duration
+	MinVersion     uint16
+	CipherSuites   []uint16
+	// ClientCAFile enables mutual TLS, client certificates must be signed by
+	// one of its certificates.
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+}
+
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// ParseVersion parses a minimum TLS version, "1.2" or "1.3".
+func ParseVersion(s string) (uint16, error) {
+	switch s {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q, use 1.2 or 1.3", s)
+	}
+}
+
+// ParseCipherPolicy returns the TLS 1.2 cipher suites of a policy.
+func ParseCipherPolicy(s string) ([]uint16, error) {
+	switch s {
+	case PolicyIntermediate:
+		return intermediateSuites, nil
+	case PolicyCompatible:
+		var suites []uint16
+		for _, suite := range tls.CipherSuites() {
+			suites = append(suites, suite.ID)
+		}
+		return suites, nil
+	default:
+		return nil, fmt.Errorf("unknown cipher policy %q, use %s or %s", s, PolicyIntermediate, PolicyCompatible)
+	}
+}
+
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	default:
+		return 0, fmt.Errorf("unknown client auth %q, use %s or %s", s, ClientAuthRequire, ClientAuthVerifyIfGiven)
+	}
+}
+
+// New returns a server config that serves the current certificate of certs
+// and offers HTTP/2 through ALPN.
+func New(config Config, certs *Reloader) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:     config.MinVersion,
+		CipherSuites:   config.CipherSuites,
+		GetCertificate: certs.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = config.ClientAuth
+	}
+
+	return tlsConfig, nil
+}
+
+// Reloader serves a certificate and key pair that can be replaced on disk,
+// for example by cert-manager or certbot, without restarting.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+
+	mu       sync.Mutex
+	modTimes [2]time.Time
+}
+
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the pair from disk, the current certificate is kept if that
+// fails.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modTimes = r.stat()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	r.cert.Store(&cert)
+	slog.Info("tls: loaded certificate", "path", r.certFile,
+		"subject", cert.Leaf.Subject.String(),
+		"not_after", cert.Leaf.NotAfter,
+	)
+	return nil
+}
+
+func (r *Reloader) stat() [2]time.Time {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, modTime := range r.stat() {
+		if !modTime.Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Watch reloads the pair whenever the modification time of either file
+// changes, until ctx is cancelled. A certificate and key that do not match,
+// such as while they are being replaced one at a time, are logged and the
+// current certificate is kept.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				slog.Error("tls: keeping previous certificate", "path", r.certFile, "error", err)
+			}
+		}
+	}
+}
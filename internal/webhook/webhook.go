@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lostxs/BackDev-test/internal/store"
+)
+
+const (
+	EventSessionCreated     = "session.created"
+	EventSessionRefreshed   = "session.refreshed"
+	EventIPChanged          = "ip.changed"
+	EventTokenReuseDetected = "token.reuse_detected"
+	EventUserLocked         = "user.locked"
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	IDHeader        = "X-Webhook-Id"
+
+	// OutboxKind is the outbox message kind handled by Sender.Deliver.
+	OutboxKind = store.OutboxKindWebhook
+)
+
+var EventTypes = []string{
+	EventSessionCreated,
+	EventSessionRefreshed,
+	EventIPChanged,
+	EventTokenReuseDetected,
+	EventUserLocked,
+}
+
+func IsEventType(eventType string) bool {
+	return slices.Contains(EventTypes, eventType)
+}
+
+type Event struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Data       map[string]any `json:"data"`
+}
+
+// Delivery is the outbox payload of a single event addressed to one endpoint.
+type Delivery struct {
+	EndpointID string `json:"endpoint_id"`
+	Event      Event  `json:"event"`
+}
+
+// Sign returns the signature header value for body sent at timestamp. The
+// receiver recomputes HMAC-SHA256 over "<timestamp>.<body>" with the shared
+// secret and should reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+type Store interface {
+	GetByID(ctx context.Context, id string) (*store.WebhookEndpoint, error)
+	LogDelivery(ctx context.Context, delivery *store.WebhookDelivery) error
+}
+
+// Sender delivers webhook outbox messages and records every attempt in the
+// delivery log, retries are left to the outbox worker.
+type Sender struct {
+	store  Store
+	client *http.Client
+}
+
+func NewSender(store Store, timeout time.Duration) *Sender {
+	return &Sender{
+		store: store,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (s *Sender) Deliver(ctx context.Context, msg *store.OutboxMessage) error {
+	var delivery Delivery
+	if err := json.Unmarshal(msg.Payload, &delivery); err != nil {
+		return err
+	}
+
+	endpoint, err := s.store.GetByID(ctx, delivery.EndpointID)
+	if err != nil {
+		if err == store.ErrWebhookNotFound {
+			// The endpoint was deleted after the event was enqueued.
+			return nil
+		}
+		return err
+	}
+
+	if !endpoint.Active {
+		return nil
+	}
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	status, sendErr := s.send(ctx, endpoint, delivery.Event, msg.IdempotencyKey, body)
+
+	entry := &store.WebhookDelivery{
+		EndpointID:     endpoint.ID,
+		OutboxID:       msg.ID,
+		EventID:        delivery.Event.ID,
+		EventType:      delivery.Event.Type,
+		ResponseStatus: status,
+		DurationMS:     time.Since(start).Milliseconds(),
+	}
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+	}
+
+	if err := s.store.LogDelivery(ctx, entry); err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+func (s *Sender) send(ctx context.Context, endpoint *store.WebhookEndpoint, event Event, id string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, id)
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, time.Now(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}